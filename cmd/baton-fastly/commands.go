@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"os/user"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/logging"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/conductorone/baton-fastly/pkg/connector"
+)
+
+// loadCommandConfig populates the config for the connector specific subcommands the same way the
+// baton-sdk does it for the root command: from flags and BATON_ prefixed environment variables.
+func loadCommandConfig(ctx context.Context, cmd *cobra.Command, cfg *config) (context.Context, error) {
+	v := viper.New()
+	v.SetEnvPrefix("baton")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	if err := v.BindPFlags(cmd.Flags()); err != nil {
+		return nil, err
+	}
+
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, err
+	}
+
+	runCtx, err := logging.Init(
+		ctx,
+		logging.WithLogFormat(v.GetString("log-format")),
+		logging.WithLogLevel(v.GetString("log-level")),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateConfig(runCtx, cfg); err != nil {
+		return nil, err
+	}
+
+	return runCtx, nil
+}
+
+func createAccountCmd(ctx context.Context, cfg *config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create-account",
+		Short: "Create a Fastly account, or invite it when --invite-accounts is set",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runCtx, err := loadCommandConfig(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+
+			account, _ := cmd.Flags().GetString("account")
+			email, _ := cmd.Flags().GetString("email")
+			name, _ := cmd.Flags().GetString("name")
+			role, _ := cmd.Flags().GetString("role")
+
+			cb, err := newFastly(runCtx, cfg)
+			if err != nil {
+				return err
+			}
+
+			resource, err := cb.CreateAccount(runCtx, account, email, name, role)
+			if err != nil {
+				return err
+			}
+
+			out, err := protojson.Marshal(resource)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintln(os.Stdout, string(out))
+			return err
+		},
+	}
+
+	cmd.Flags().String("account", "", "Name of the account from account-tokens to create the account in")
+	cmd.Flags().String("email", "", "Email address (login) of the new account")
+	cmd.Flags().String("name", "", "Name of the new account")
+	cmd.Flags().String("role", "user", "Role of the new account")
+	_ = cmd.MarkFlagRequired("email")
+
+	return cmd
+}
+
+func expireGrantsCmd(ctx context.Context, cfg *config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "expire-grants",
+		Short: "Revert the time-bound grants that have expired to the access held before them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runCtx, err := loadCommandConfig(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+
+			cb, err := newFastly(runCtx, cfg)
+			if err != nil {
+				return err
+			}
+
+			reverted, err := cb.ExpireGrants(runCtx)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(os.Stdout, "reverted %d expired grants\n", reverted)
+			return err
+		},
+	}
+}
+
+func breakGlassCmd(ctx context.Context, cfg *config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "break-glass",
+		Short: "Temporarily elevate a user to a role or to full access on services, with a reason recorded in the audit file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runCtx, err := loadCommandConfig(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+
+			if cfg.GrantStateFile == "" || cfg.AuditFile == "" {
+				return fmt.Errorf("grant-state-file and audit-file are required to break glass")
+			}
+
+			req := &connector.BreakGlassRequest{Operator: currentOperator()}
+			req.Account, _ = cmd.Flags().GetString("account")
+			req.User, _ = cmd.Flags().GetString("user")
+			req.Role, _ = cmd.Flags().GetString("role")
+			req.Services, _ = cmd.Flags().GetStringSlice("services")
+			req.Reason, _ = cmd.Flags().GetString("reason")
+			req.Duration, _ = cmd.Flags().GetDuration("duration")
+			wait, _ := cmd.Flags().GetBool("wait")
+
+			cb, err := newFastly(runCtx, cfg)
+			if err != nil {
+				return err
+			}
+
+			expiresAt, err := cb.BreakGlass(runCtx, req)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stdout, "elevated %s until %s\n", req.User, expiresAt.Format(time.RFC3339))
+
+			if !wait || cfg.DryRun {
+				return nil
+			}
+
+			waitCtx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			select {
+			case <-time.After(time.Until(expiresAt)):
+			case <-waitCtx.Done():
+				fmt.Fprintln(os.Stdout, "interrupted, the elevation is rolled back by expire-grants or the connector in daemon mode once it expires")
+				return nil
+			}
+
+			reverted, err := cb.ExpireGrants(runCtx)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(os.Stdout, "rolled back %d expired grants\n", reverted)
+			return err
+		},
+	}
+
+	cmd.Flags().String("account", "", "Name of the account from account-tokens the user belongs to")
+	cmd.Flags().String("user", "", "ID or login of the user to elevate")
+	cmd.Flags().String("role", "", "Role to elevate the user to, e.g. Superuser")
+	cmd.Flags().StringSlice("services", nil, "IDs of the services to grant full access on")
+	cmd.Flags().String("reason", "", "Why the elevation is needed, recorded in the audit file")
+	cmd.Flags().Duration("duration", time.Hour, "How long the elevation lasts before it is rolled back")
+	cmd.Flags().Bool("wait", true, "Wait for the elevation to expire and roll it back")
+	_ = cmd.MarkFlagRequired("user")
+	_ = cmd.MarkFlagRequired("reason")
+
+	return cmd
+}
+
+// currentOperator returns the name of the local user running the command, for the audit file.
+func currentOperator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+func policyCmd(ctx context.Context, cfg *config, use, short string, apply bool) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runCtx, err := loadCommandConfig(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+
+			account, _ := cmd.Flags().GetString("account")
+			policyFile, _ := cmd.Flags().GetString("policy")
+
+			policy, err := connector.LoadPolicy(policyFile)
+			if err != nil {
+				return err
+			}
+
+			cb, err := newFastly(runCtx, cfg)
+			if err != nil {
+				return err
+			}
+
+			plan, err := cb.PlanPolicy(runCtx, account, policy)
+			if err != nil {
+				return err
+			}
+
+			if err := plan.Write(os.Stdout); err != nil {
+				return err
+			}
+
+			if !apply {
+				return nil
+			}
+
+			return plan.Apply(runCtx, os.Stdout)
+		},
+	}
+
+	cmd.Flags().String("account", "", "Name of the account from account-tokens the policy is for")
+	cmd.Flags().String("policy", "", "YAML file of the users, their roles and their permissions on services")
+	_ = cmd.MarkFlagRequired("policy")
+
+	return cmd
+}
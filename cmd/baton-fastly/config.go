@@ -3,27 +3,157 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/conductorone/baton-sdk/pkg/cli"
 	"github.com/spf13/cobra"
+
+	"github.com/conductorone/baton-fastly/pkg/connector"
 )
 
 // config defines the external configuration required for the connector to run.
 type config struct {
 	cli.BaseConfig `mapstructure:",squash"` // Puts the base config options in the same place as the connector options
 
-	AccessToken string `mapstructure:"access-token"`
+	AccessToken          string        `mapstructure:"access-token"`
+	AccessTokenFile      string        `mapstructure:"access-token-file"`
+	AccessTokenCommand   string        `mapstructure:"access-token-command"`
+	AccountTokens        []string      `mapstructure:"account-tokens"`
+	InviteAccounts       bool          `mapstructure:"invite-accounts"`
+	ServiceAccountLogins []string      `mapstructure:"service-account-logins"`
+	ActivityLookback     time.Duration `mapstructure:"activity-lookback"`
+	AvatarBaseURL        string        `mapstructure:"avatar-base-url"`
+	AvatarMaxSize        int64         `mapstructure:"avatar-max-size"`
+	ResourceTypes        []string      `mapstructure:"resource-types"`
+	SkipResourceTypes    []string      `mapstructure:"skip-resource-types"`
+	IncludeServices      []string      `mapstructure:"include-services"`
+	ExcludeServices      []string      `mapstructure:"exclude-services"`
+	ServiceTypes         []string      `mapstructure:"service-types"`
+	ProxyURL             string        `mapstructure:"proxy-url"`
+	CABundle             string        `mapstructure:"ca-bundle"`
+	TLSClientCert        string        `mapstructure:"tls-client-cert"`
+	TLSClientKey         string        `mapstructure:"tls-client-key"`
+	ReadOnly             bool          `mapstructure:"read-only"`
+	DryRun               bool          `mapstructure:"dry-run"`
+	GrantDurations       []string      `mapstructure:"grant-durations"`
+	GrantStateFile       string        `mapstructure:"grant-state-file"`
+	AuditFile            string        `mapstructure:"audit-file"`
 }
 
 // validateConfig is run after the configuration is loaded, and should return an error if it isn't valid.
 func validateConfig(ctx context.Context, cfg *config) error {
-	if cfg.AccessToken == "" {
-		return fmt.Errorf("access-token is required")
+	credentials := 0
+	for _, set := range []bool{cfg.AccessToken != "", cfg.AccessTokenFile != "", cfg.AccessTokenCommand != "", len(cfg.AccountTokens) > 0} {
+		if set {
+			credentials++
+		}
+	}
+
+	if credentials == 0 {
+		return fmt.Errorf("one of access-token, access-token-file, access-token-command or account-tokens is required")
+	}
+
+	if credentials > 1 {
+		return fmt.Errorf("only one of access-token, access-token-file, access-token-command and account-tokens can be used")
+	}
+
+	if _, err := parseAccountTokens(cfg.AccountTokens); err != nil {
+		return err
+	}
+
+	if cfg.ActivityLookback <= 0 {
+		return fmt.Errorf("activity-lookback must be positive")
+	}
+
+	if cfg.AvatarMaxSize <= 0 {
+		return fmt.Errorf("avatar-max-size must be positive")
+	}
+
+	if (cfg.TLSClientCert == "") != (cfg.TLSClientKey == "") {
+		return fmt.Errorf("tls-client-cert and tls-client-key must be used together")
+	}
+
+	if _, err := parseGrantDurations(cfg.GrantDurations); err != nil {
+		return err
+	}
+
+	if len(cfg.GrantDurations) > 0 && cfg.GrantStateFile == "" {
+		return fmt.Errorf("grant-state-file is required with grant-durations")
 	}
 
 	return nil
 }
 
+// parseAccountTokens parses the name=token pairs of the account-tokens option.
+func parseAccountTokens(values []string) (map[string]string, error) {
+	rv := make(map[string]string, len(values))
+
+	for _, value := range values {
+		name, token, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("account-tokens must be name=token pairs")
+		}
+
+		if _, ok := rv[name]; ok {
+			return nil, fmt.Errorf("account-tokens contains account %q more than once", name)
+		}
+
+		rv[name] = token
+	}
+
+	return rv, nil
+}
+
+// parseGrantDurations parses the entitlement=duration pairs of the grant-durations option.
+func parseGrantDurations(values []string) (map[string]time.Duration, error) {
+	rv := make(map[string]time.Duration, len(values))
+
+	for _, value := range values {
+		key, d, ok := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("grant-durations must be entitlement=duration pairs")
+		}
+
+		duration, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("grant-durations has an invalid duration for %q", key)
+		}
+
+		if _, ok := rv[key]; ok {
+			return nil, fmt.Errorf("grant-durations contains %q more than once", key)
+		}
+
+		rv[key] = duration
+	}
+
+	return rv, nil
+}
+
 func cmdFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().String("access-token", "", "Fastly API token")
+	cmd.PersistentFlags().String("access-token-file", "", "File containing the Fastly API token, re-read whenever it changes")
+	cmd.PersistentFlags().String("access-token-command", "", "Shell command printing the Fastly API token, run again whenever the token is rejected")
+	cmd.PersistentFlags().StringSlice("account-tokens", nil, "Fastly API tokens of several accounts to sync, as name=token pairs")
+	cmd.PersistentFlags().Bool("invite-accounts", false, "Create new accounts by sending an invitation instead of creating the user directly")
+	cmd.PersistentFlags().StringSlice("service-account-logins", nil, "Glob patterns of logins that are service accounts, e.g. \"*@svc.example.com\"")
+	cmd.PersistentFlags().Duration("activity-lookback", connector.DefaultActivityLookback, "How far back the event log is scanned for the last activity of users")
+	cmd.PersistentFlags().String("avatar-base-url", connector.DefaultAvatarBaseURL, "URL user avatars are fetched from by their email hash")
+	cmd.PersistentFlags().Int64("avatar-max-size", connector.DefaultAvatarMaxSize, "Largest user avatar in bytes that is served")
+	cmd.PersistentFlags().StringSlice("resource-types", nil, "Only sync these resource types, e.g. \"user,role\"")
+	cmd.PersistentFlags().StringSlice("skip-resource-types", nil, "Do not sync these resource types")
+	cmd.PersistentFlags().StringSlice("include-services", nil, "Only sync services matching these IDs, name globs or \"re:\" prefixed name regular expressions")
+	cmd.PersistentFlags().StringSlice("exclude-services", nil, "Do not sync services matching these IDs, name globs or \"re:\" prefixed name regular expressions")
+	cmd.PersistentFlags().StringSlice("service-types", nil, "Only sync services of these types: vcl, wasm")
+	cmd.PersistentFlags().String("proxy-url", "", "HTTP proxy for the requests to Fastly, including credentials of an authenticating proxy")
+	cmd.PersistentFlags().String("ca-bundle", "", "PEM file of CA certificates to trust in addition to the system ones")
+	cmd.PersistentFlags().String("tls-client-cert", "", "PEM file of the client certificate for mutual TLS")
+	cmd.PersistentFlags().String("tls-client-key", "", "PEM file of the key of the client certificate for mutual TLS")
+	cmd.PersistentFlags().StringSlice("grant-durations", nil, "Make grants expire, as entitlement=duration pairs, e.g. \"purge-all=4h,role:Superuser=1h\", or \"*=8h\" for all roles and service permissions")
+	cmd.PersistentFlags().String("grant-state-file", "", "File time-bound grants and the access held before them are kept in")
+	cmd.PersistentFlags().String("audit-file", "", "File break glass elevations and rollbacks of expired grants are appended to")
+	cmd.PersistentFlags().Bool("read-only", false, "Refuse every request that would change something in Fastly, even when provisioning is enabled")
+	cmd.PersistentFlags().Bool("dry-run", false, "Report the Fastly API calls that role and service grants and revokes would make instead of making them")
 }
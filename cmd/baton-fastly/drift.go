@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	reader_v2 "github.com/conductorone/baton-sdk/pb/c1/reader/v2"
+	"github.com/conductorone/baton-sdk/pkg/dotc1z"
+	"github.com/spf13/cobra"
+
+	"github.com/conductorone/baton-fastly/pkg/connector"
+)
+
+// driftExitCode is the exit code of the drift command when the live state differs from the snapshot,
+// so that CI can tell drift apart from failures, which exit with 1.
+const driftExitCode = 2
+
+// driftError is returned by the drift command when the live state differs from the snapshot, so that
+// main exits with driftExitCode once the command has cleaned up.
+type driftError struct {
+	report *connector.DriftReport
+}
+
+func (e *driftError) Error() string {
+	return fmt.Sprintf("drift detected: %d added, %d removed, %d changed", e.report.Added, e.report.Removed, e.report.Changed)
+}
+
+func driftCmd(ctx context.Context, cfg *config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "drift",
+		Short: "Report the role and service grants that changed since the sync in --file, exiting with 2 on drift",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runCtx, err := loadCommandConfig(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+
+			snapshot, syncId, err := loadSnapshotGrants(runCtx, cfg.C1zPath, cfg.C1zTempDir)
+			if err != nil {
+				return err
+			}
+
+			cb, err := newFastly(runCtx, cfg)
+			if err != nil {
+				return err
+			}
+
+			live, err := cb.LiveGrants(runCtx)
+			if err != nil {
+				return err
+			}
+
+			report := connector.DiffGrants(snapshot, live)
+			report.Snapshot = cfg.C1zPath
+			report.SyncID = syncId
+
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			if _, err := fmt.Fprintln(os.Stdout, string(out)); err != nil {
+				return err
+			}
+
+			if report.HasDrift() {
+				return &driftError{report: report}
+			}
+
+			return nil
+		},
+	}
+}
+
+// loadSnapshotGrants returns the grants of the drift resource types from the latest finished sync of the c1z file.
+func loadSnapshotGrants(ctx context.Context, path, tmpDir string) ([]*v2.Grant, string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, "", fmt.Errorf("failed to open snapshot: %w", err)
+	}
+
+	store, err := dotc1z.NewC1ZFile(ctx, path, dotc1z.WithTmpDir(tmpDir))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer store.Close()
+
+	syncId, err := store.LatestSyncID(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if syncId == "" {
+		return nil, "", fmt.Errorf("snapshot %s has no finished sync", path)
+	}
+
+	if err := store.ViewSync(ctx, syncId); err != nil {
+		return nil, "", err
+	}
+
+	var rv []*v2.Grant
+	for _, resourceTypeId := range connector.DriftResourceTypes {
+		pageToken := ""
+		for {
+			resp, err := store.ListGrantsForResourceType(ctx, &reader_v2.GrantsReaderServiceListGrantsForResourceTypeRequest{
+				ResourceTypeId: resourceTypeId,
+				PageToken:      pageToken,
+			})
+			if err != nil {
+				return nil, "", err
+			}
+
+			rv = append(rv, resp.List...)
+
+			if resp.NextPageToken == "" {
+				break
+			}
+
+			pageToken = resp.NextPageToken
+		}
+	}
+
+	return rv, syncId, nil
+}
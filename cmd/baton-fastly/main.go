@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/conductorone/baton-sdk/pkg/cli"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
@@ -16,6 +18,9 @@ import (
 
 var version = "dev"
 
+// grantExpiryInterval is how often the connector reverts expired grants in daemon mode.
+const grantExpiryInterval = time.Minute
+
 func main() {
 	ctx := context.Background()
 
@@ -28,18 +33,66 @@ func main() {
 
 	cmd.Version = version
 	cmdFlags(cmd)
+	cmd.AddCommand(createAccountCmd(ctx, cfg))
+	cmd.AddCommand(expireGrantsCmd(ctx, cfg))
+	cmd.AddCommand(breakGlassCmd(ctx, cfg))
+	cmd.AddCommand(policyCmd(ctx, cfg, "plan", "Show the changes that would make the account match an access policy", false))
+	cmd.AddCommand(policyCmd(ctx, cfg, "apply", "Make the account match an access policy through the regular grants and revokes", true))
+	cmd.AddCommand(driftCmd(ctx, cfg))
 
 	err = cmd.Execute()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
+
+		var drift *driftError
+		if errors.As(err, &drift) {
+			os.Exit(driftExitCode)
+		}
+
 		os.Exit(1)
 	}
 }
 
+func newFastly(ctx context.Context, cfg *config) (*connector.Fastly, error) {
+	accountTokens, err := parseAccountTokens(cfg.AccountTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	grantDurations, err := parseGrantDurations(cfg.GrantDurations)
+	if err != nil {
+		return nil, err
+	}
+
+	return connector.New(
+		ctx,
+		cfg.AccessToken,
+		connector.WithAccessTokenFile(cfg.AccessTokenFile),
+		connector.WithAccessTokenCommand(cfg.AccessTokenCommand),
+		connector.WithAccountTokens(accountTokens),
+		connector.WithInviteAccounts(cfg.InviteAccounts),
+		connector.WithServiceAccountLoginPatterns(cfg.ServiceAccountLogins),
+		connector.WithActivityLookback(cfg.ActivityLookback),
+		connector.WithAvatarBaseURL(cfg.AvatarBaseURL),
+		connector.WithAvatarMaxSize(cfg.AvatarMaxSize),
+		connector.WithResourceTypes(cfg.ResourceTypes),
+		connector.WithoutResourceTypes(cfg.SkipResourceTypes),
+		connector.WithServiceFilter(cfg.IncludeServices, cfg.ExcludeServices, cfg.ServiceTypes),
+		connector.WithProxyURL(cfg.ProxyURL),
+		connector.WithCABundle(cfg.CABundle),
+		connector.WithClientCertificate(cfg.TLSClientCert, cfg.TLSClientKey),
+		connector.WithReadOnly(cfg.ReadOnly),
+		connector.WithDryRun(cfg.DryRun),
+		connector.WithGrantDurations(grantDurations),
+		connector.WithGrantStateFile(cfg.GrantStateFile),
+		connector.WithAuditFile(cfg.AuditFile),
+	)
+}
+
 func getConnector(ctx context.Context, cfg *config) (types.ConnectorServer, error) {
 	l := ctxzap.Extract(ctx)
 
-	cb, err := connector.New(ctx, cfg.AccessToken)
+	cb, err := newFastly(ctx, cfg)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
@@ -51,5 +104,10 @@ func getConnector(ctx context.Context, cfg *config) (types.ConnectorServer, erro
 		return nil, err
 	}
 
+	// In daemon mode the connector keeps running, so it reverts expired grants itself.
+	if cfg.ClientID != "" && cfg.GrantStateFile != "" && !cfg.ReadOnly && !cfg.DryRun {
+		go cb.ExpireGrantsEvery(ctx, grantExpiryInterval)
+	}
+
 	return c, nil
 }
@@ -0,0 +1,164 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+const (
+	passwordPolicyPCI      = "pci"
+	passwordPolicyStandard = "standard"
+)
+
+// customer is the subset of the Fastly customer that describes the account's security posture.
+// The go-fastly v8 client has no support for the endpoint, so it is called directly.
+type customer struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	OwnerID         string     `json:"owner_id"`
+	PricingPlan     string     `json:"pricing_plan"`
+	Force2FA        bool       `json:"force_2fa"`
+	ForceSSO        bool       `json:"force_sso"`
+	HasPCIPasswords bool       `json:"has_pci_passwords"`
+	IPAllowlist     string     `json:"ip_whitelist"`
+	CreatedAt       *time.Time `json:"created_at"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+}
+
+func getCustomer(client *fastly.Client, customerId string) (*customer, error) {
+	resp, err := client.Get(fmt.Sprintf("/customer/%s", customerId), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var rv customer
+	if err := json.NewDecoder(resp.Body).Decode(&rv); err != nil {
+		return nil, fmt.Errorf("failed to decode customer response: %w", err)
+	}
+
+	return &rv, nil
+}
+
+// loginIPAllowlist splits the comma separated list of addresses allowed to log in.
+func (c *customer) loginIPAllowlist() []string {
+	var rv []string
+	for _, address := range strings.Split(c.IPAllowlist, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			rv = append(rv, address)
+		}
+	}
+
+	return rv
+}
+
+func (c *customer) passwordPolicy() string {
+	if c.HasPCIPasswords {
+		return passwordPolicyPCI
+	}
+
+	return passwordPolicyStandard
+}
+
+// securityProfile returns the security settings of the account, as published in the connector
+// metadata and in the profile of the account resource.
+func (c *customer) securityProfile() map[string]interface{} {
+	allowlist := make([]interface{}, 0)
+	for _, address := range c.loginIPAllowlist() {
+		allowlist = append(allowlist, address)
+	}
+
+	return map[string]interface{}{
+		"force_2fa":          c.Force2FA,
+		"force_sso":          c.ForceSSO,
+		"password_policy":    c.passwordPolicy(),
+		"login_ip_allowlist": allowlist,
+	}
+}
+
+type accountBuilder struct {
+	resourceType *v2.ResourceType
+	client       *fastly.Client
+	customerId   string
+	accountName  string
+}
+
+func (o *accountBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return accountResourceType
+}
+
+func newAccountResource(ctx context.Context, customer *customer, accountName string) (*v2.Resource, error) {
+	profile := customer.securityProfile()
+	profile["id"] = customer.ID
+	profile["name"] = customer.Name
+
+	if accountName != "" {
+		profile["account_name"] = accountName
+	}
+
+	if customer.OwnerID != "" {
+		profile["owner_id"] = customer.OwnerID
+	}
+
+	if customer.PricingPlan != "" {
+		profile["pricing_plan"] = customer.PricingPlan
+	}
+
+	addTimeToProfile(profile, "created_at", customer.CreatedAt)
+	addTimeToProfile(profile, "updated_at", customer.UpdatedAt)
+
+	appTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	resource, err := rs.NewAppResource(customer.Name, accountResourceType, customer.ID, appTraitOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns the account the access token belongs to.
+func (o *accountBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	customer, err := getCustomer(o.client, o.customerId)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error getting account")
+	}
+
+	resource, err := newAccountResource(ctx, customer, o.accountName)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error creating account resource")
+	}
+
+	return []*v2.Resource{resource}, "", nil, nil
+}
+
+// Entitlements always returns an empty slice for the account.
+func (o *accountBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants always returns an empty slice for the account since it doesn't have any entitlements.
+func (o *accountBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func newAccountBuilder(client *fastly.Client, customerId, accountName string) *accountBuilder {
+	return &accountBuilder{
+		resourceType: accountResourceType,
+		client:       client,
+		customerId:   customerId,
+		accountName:  accountName,
+	}
+}
@@ -0,0 +1,164 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+const aclEntriesPageSize = 100
+
+type aclBuilder struct {
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+	cache         *syncCache
+}
+
+func (o *aclBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return aclResourceType
+}
+
+func newACLResource(ctx context.Context, acl *fastly.ACL, entryCount int, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"id":              acl.ID,
+		"name":            acl.Name,
+		"service_id":      acl.ServiceID,
+		"service_version": acl.ServiceVersion,
+		"entry_count":     entryCount,
+	}
+
+	addTimeToProfile(profile, "created_at", acl.CreatedAt)
+	addTimeToProfile(profile, "updated_at", acl.UpdatedAt)
+
+	appTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	resource, err := rs.NewAppResource(
+		acl.Name,
+		aclResourceType,
+		acl.ID,
+		appTraitOptions,
+		rs.WithParentResourceID(parentResourceID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (o *aclBuilder) countEntries(acl *fastly.ACL) (int, error) {
+	paginator := o.client.NewListACLEntriesPaginator(&fastly.ListACLEntriesInput{
+		ACLID:     acl.ID,
+		ServiceID: acl.ServiceID,
+		PerPage:   aclEntriesPageSize,
+	})
+
+	count := 0
+	for paginator.HasNext() {
+		entries, err := paginator.GetNext()
+		if err != nil {
+			return 0, err
+		}
+
+		count += len(entries)
+	}
+
+	return count, nil
+}
+
+// List returns the ACLs of the active version of the parent service.
+func (o *aclBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	allowed, err := o.serviceFilter.allowsServiceId(o.client, parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error filtering service")
+	}
+
+	if !allowed {
+		return nil, "", nil, nil
+	}
+
+	activeVersion, err := o.cache.activeVersion(parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error getting active service version")
+	}
+
+	if activeVersion == 0 {
+		return nil, "", nil, nil
+	}
+
+	acls, err := o.client.ListACLs(&fastly.ListACLsInput{
+		ServiceID:      parentResourceID.Resource,
+		ServiceVersion: activeVersion,
+	})
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error listing ACLs")
+	}
+
+	if len(acls) == 0 {
+		return nil, "", nil, nil
+	}
+
+	var resources []*v2.Resource
+	for _, acl := range acls {
+		entryCount, err := o.countEntries(acl)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error listing ACL entries")
+		}
+
+		resource, err := newACLResource(ctx, acl, entryCount, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating ACL resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *aclBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+
+	assigmentOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(userResourceType),
+		ent.WithDescription(fmt.Sprintf("Manage entries of %s ACL", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s of %s", manageEntriesEntitlement, resource.DisplayName)),
+	}
+	rv = append(rv, ent.NewAssignmentEntitlement(resource, manageEntriesEntitlement, assigmentOptions...))
+
+	return rv, "", nil, nil
+}
+
+// Grants returns a manage-entries grant for every user that can modify the parent service.
+func (o *aclBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	rv, err := grantManageEntries(o.cache, resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "failed to create manage-entries grants")
+	}
+
+	return rv, "", nil, nil
+}
+
+func newACLBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter, cache *syncCache) *aclBuilder {
+	return &aclBuilder{
+		resourceType:  aclResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+		cache:         cache,
+	}
+}
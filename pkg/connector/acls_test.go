@@ -0,0 +1,67 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+)
+
+func TestGrantManageEntries(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.addUser("u-super", "super", "superuser")
+	f.addUser("u-full", "full", "engineer")
+	f.addUser("u-purge", "purge", "engineer")
+	f.addUser("u-read", "read", "engineer")
+	f.addUser("u-other", "other", "engineer")
+	f.addAuthorization("svc-a", "u-full", FullAccessPermission)
+	f.addAuthorization("svc-a", "u-purge", PurgeAllPermission)
+	f.addAuthorization("svc-a", "u-read", ReadOnlyPermission)
+	f.addAuthorization("svc-b", "u-other", FullAccessPermission)
+
+	client := f.client()
+	cache := newSyncCache(client, "cust")
+	acls := newACLBuilder(client, "cust", nil, cache)
+	dictionaries := newDictionaryBuilder(client, "cust", nil, cache)
+
+	service := &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc-a"}
+	resources := []struct {
+		syncer   connectorbuilder.ResourceSyncer
+		resource *v2.Resource
+	}{
+		{acls, &v2.Resource{Id: &v2.ResourceId{ResourceType: aclResourceType.Id, Resource: "acl-1"}, ParentResourceId: service}},
+		{acls, &v2.Resource{Id: &v2.ResourceId{ResourceType: aclResourceType.Id, Resource: "acl-2"}, ParentResourceId: service}},
+		{dictionaries, &v2.Resource{Id: &v2.ResourceId{ResourceType: dictionaryResourceType.Id, Resource: "dict-1"}, ParentResourceId: service}},
+	}
+
+	for _, r := range resources {
+		grants, _, _, err := r.syncer.Grants(context.Background(), r.resource, &pagination.Token{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var userIds []string
+		for _, g := range grants {
+			userIds = append(userIds, g.Principal.Id.Resource)
+		}
+		sort.Strings(userIds)
+
+		want := []string{"u-full", "u-purge", "u-super"}
+		if !reflect.DeepEqual(userIds, want) {
+			t.Errorf("manage-entries of %s = %v, want %v", r.resource.Id.Resource, userIds, want)
+		}
+	}
+
+	if count := f.countRequests(http.MethodGet, "/service-authorizations"); count != 1 {
+		t.Errorf("service authorizations were listed %d times, want once per sync", count)
+	}
+
+	if count := f.countRequests(http.MethodGet, "/customer/cust/users"); count != 1 {
+		t.Errorf("users were listed %d times, want once per sync", count)
+	}
+}
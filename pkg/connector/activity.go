@@ -0,0 +1,176 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+// DefaultActivityLookback is how far back the event log is scanned for user activity by default.
+const DefaultActivityLookback = 90 * 24 * time.Hour
+
+type eventAttributes struct {
+	CreatedAt *time.Time `json:"created_at"`
+	EventType string     `json:"event_type"`
+	UserID    string     `json:"user_id"`
+}
+
+type event struct {
+	ID         string          `json:"id"`
+	Attributes eventAttributes `json:"attributes"`
+}
+
+type eventsResponse struct {
+	Data  []event `json:"data"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+// listEventsSince returns the account's events created after since. GetAPIEvents of the go-fastly v8
+// client cannot filter by date and always fetches the whole event log, so the endpoint is called directly.
+func listEventsSince(client *fastly.Client, customerId string, since time.Time) ([]event, error) {
+	var rv []event
+
+	for page := 1; ; page++ {
+		resp, err := client.Get("/events", &fastly.RequestOptions{
+			Headers: map[string]string{"Accept": jsonAPIContentType},
+			Params: map[string]string{
+				"filter[customer_id]":     customerId,
+				"filter[created_at][gte]": since.UTC().Format(time.RFC3339),
+				"page[number]":            strconv.Itoa(page),
+				"page[size]":              strconv.Itoa(resourcePageSize),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var body eventsResponse
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode events response: %w", err)
+		}
+
+		rv = append(rv, body.Data...)
+
+		if body.Links.Next == "" || len(body.Data) == 0 {
+			break
+		}
+	}
+
+	return rv, nil
+}
+
+// userActivity is the activity of a single user within the look-back window.
+type userActivity struct {
+	lastLogin    *time.Time
+	lastActivity *time.Time
+}
+
+// activityReport holds the activity of all users of the account, gathered once per sync.
+type activityReport struct {
+	since  time.Time
+	users  map[string]*userActivity
+	tokens map[string][]*fastly.Token
+}
+
+func laterTime(current, t *time.Time) *time.Time {
+	if t == nil || (current != nil && !t.After(*current)) {
+		return current
+	}
+
+	return t
+}
+
+// newActivityReport scans the event log and the account's tokens once and records the last
+// login and the last event of every user.
+func newActivityReport(client *fastly.Client, customerId string, lookback time.Duration) (*activityReport, error) {
+	rv := &activityReport{
+		since:  time.Now().Add(-lookback),
+		users:  make(map[string]*userActivity),
+		tokens: make(map[string][]*fastly.Token),
+	}
+
+	events, err := listEventsSince(client, customerId, rv.since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	for _, event := range events {
+		if event.Attributes.UserID == "" {
+			continue
+		}
+
+		activity, ok := rv.users[event.Attributes.UserID]
+		if !ok {
+			activity = &userActivity{}
+			rv.users[event.Attributes.UserID] = activity
+		}
+
+		if event.Attributes.EventType == loginEventType {
+			activity.lastLogin = laterTime(activity.lastLogin, event.Attributes.CreatedAt)
+		}
+
+		activity.lastActivity = laterTime(activity.lastActivity, event.Attributes.CreatedAt)
+	}
+
+	tokens, err := client.ListCustomerTokens(&fastly.ListCustomerTokensInput{CustomerID: customerId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	for _, token := range tokens {
+		rv.tokens[token.UserID] = append(rv.tokens[token.UserID], token)
+	}
+
+	return rv, nil
+}
+
+// loggedIn returns true if the user logged in interactively within the look-back window.
+func (r *activityReport) loggedIn(userId string) bool {
+	activity, ok := r.users[userId]
+
+	return ok && activity.lastLogin != nil
+}
+
+// addToProfile adds the user's last login, last activity and token summary to the profile.
+func (r *activityReport) addToProfile(profile map[string]interface{}, userId string) {
+	profile["activity_since"] = r.since.UTC().Format(time.RFC3339)
+
+	if activity, ok := r.users[userId]; ok {
+		addTimeToProfile(profile, "last_login_at", activity.lastLogin)
+		addTimeToProfile(profile, "last_activity_at", activity.lastActivity)
+	}
+
+	tokens := r.tokens[userId]
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Name < tokens[j].Name
+	})
+
+	var tokensLastUsed *time.Time
+	summary := make([]interface{}, 0, len(tokens))
+	for _, token := range tokens {
+		tokenProfile := map[string]interface{}{
+			"id":    token.ID,
+			"name":  token.Name,
+			"scope": string(token.Scope),
+		}
+
+		addTimeToProfile(tokenProfile, "created_at", token.CreatedAt)
+		addTimeToProfile(tokenProfile, "expires_at", token.ExpiresAt)
+		addTimeToProfile(tokenProfile, "last_used_at", token.LastUsedAt)
+
+		summary = append(summary, tokenProfile)
+		tokensLastUsed = laterTime(tokensLastUsed, token.LastUsedAt)
+	}
+
+	profile["token_count"] = len(tokens)
+	profile["tokens"] = summary
+	addTimeToProfile(profile, "tokens_last_used_at", tokensLastUsed)
+}
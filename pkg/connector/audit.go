@@ -0,0 +1,78 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	auditEventBreakGlassRequested = "break_glass_requested"
+	auditEventBreakGlass          = "break_glass"
+	auditEventBreakGlassFailed    = "break_glass_failed"
+	auditEventRollback            = "rollback"
+)
+
+// auditEntry is a line of the audit file.
+type auditEntry struct {
+	Time       time.Time  `json:"time"`
+	Event      string     `json:"event"`
+	Operator   string     `json:"operator,omitempty"`
+	CustomerID string     `json:"customer_id"`
+	UserID     string     `json:"user_id"`
+	Login      string     `json:"login,omitempty"`
+	Role       string     `json:"role,omitempty"`
+	ServiceID  string     `json:"service_id,omitempty"`
+	Permission string     `json:"permission,omitempty"`
+	Previous   string     `json:"previous,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	DryRun     bool       `json:"dry_run,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// auditLog appends JSON lines to a file that is only ever appended to, never rewritten.
+type auditLog struct {
+	path string
+	mtx  sync.Mutex
+}
+
+func newAuditLog(path string) *auditLog {
+	if path == "" {
+		return nil
+	}
+
+	return &auditLog{path: path}
+}
+
+func (a *auditLog) append(entry *auditEntry) error {
+	if a == nil {
+		return nil
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("baton-fastly: failed to open audit file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("baton-fastly: failed to write audit file: %w", err)
+	}
+
+	return f.Sync()
+}
@@ -0,0 +1,174 @@
+package connector
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+const (
+	// DefaultAvatarBaseURL is the Gravatar endpoint avatars are fetched from by default.
+	DefaultAvatarBaseURL = "https://www.gravatar.com/avatar/"
+	// DefaultAvatarMaxSize is the largest avatar, in bytes, that is served by default.
+	DefaultAvatarMaxSize = 1 << 20
+
+	avatarAssetPrefix = "avatar:"
+
+	// avatarCacheSize is how many avatars are kept in memory, the least recently served ones are evicted first.
+	avatarCacheSize = 256
+	// avatarCacheTTL is how long an avatar is kept in memory, so that changed avatars show up in daemon mode.
+	avatarCacheTTL = 24 * time.Hour
+)
+
+// emailHashPattern matches the MD5 and SHA-256 email hashes Gravatar accepts.
+var emailHashPattern = regexp.MustCompile(`^([0-9a-f]{32}|[0-9a-f]{64})$`)
+
+// avatarAssetRef returns the asset reference of the avatar of the user with the given email hash.
+func avatarAssetRef(emailHash string) *v2.AssetRef {
+	if !emailHashPattern.MatchString(emailHash) {
+		return nil
+	}
+
+	return &v2.AssetRef{Id: avatarAssetPrefix + emailHash}
+}
+
+type avatar struct {
+	emailHash   string
+	contentType string
+	data        []byte
+	fetchedAt   time.Time
+}
+
+// avatarFetcher fetches user avatars from Gravatar, keeping the avatarCacheSize most recently served
+// ones in memory for up to avatarCacheTTL.
+type avatarFetcher struct {
+	httpClient *http.Client
+	baseURL    string
+	maxSize    int64
+
+	mu    sync.Mutex
+	cache map[string]*list.Element
+	lru   *list.List
+}
+
+func newAvatarFetcher(httpClient *http.Client, baseURL string, maxSize int64) *avatarFetcher {
+	return &avatarFetcher{
+		httpClient: httpClient,
+		baseURL:    strings.TrimRight(baseURL, "/") + "/",
+		maxSize:    maxSize,
+		cache:      make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// cached returns the avatar if it is in memory and has not expired yet.
+func (f *avatarFetcher) cached(emailHash string) (*avatar, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	element, ok := f.cache[emailHash]
+	if !ok {
+		return nil, false
+	}
+
+	cached := element.Value.(*avatar)
+	if time.Since(cached.fetchedAt) > avatarCacheTTL {
+		f.lru.Remove(element)
+		delete(f.cache, emailHash)
+
+		return nil, false
+	}
+
+	f.lru.MoveToFront(element)
+
+	return cached, true
+}
+
+// store keeps the avatar in memory, evicting the least recently served one when the cache is full.
+func (f *avatarFetcher) store(a *avatar) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if element, ok := f.cache[a.emailHash]; ok {
+		element.Value = a
+		f.lru.MoveToFront(element)
+
+		return
+	}
+
+	f.cache[a.emailHash] = f.lru.PushFront(a)
+
+	for f.lru.Len() > avatarCacheSize {
+		oldest := f.lru.Back()
+		f.lru.Remove(oldest)
+		delete(f.cache, oldest.Value.(*avatar).emailHash)
+	}
+}
+
+// fetch returns the content type and a reader of the avatar referenced by the asset.
+func (f *avatarFetcher) fetch(ctx context.Context, asset *v2.AssetRef) (string, io.ReadCloser, error) {
+	emailHash, ok := strings.CutPrefix(asset.GetId(), avatarAssetPrefix)
+	if !ok || !emailHashPattern.MatchString(emailHash) {
+		return "", nil, fmt.Errorf("baton-fastly: unknown asset %q", asset.GetId())
+	}
+
+	cached, ok := f.cached(emailHash)
+	if !ok {
+		var err error
+		cached, err = f.download(ctx, emailHash)
+		if err != nil {
+			return "", nil, err
+		}
+
+		f.store(cached)
+	}
+
+	return cached.contentType, io.NopCloser(bytes.NewReader(cached.data)), nil
+}
+
+func (f *avatarFetcher) download(ctx context.Context, emailHash string) (*avatar, error) {
+	// d=404 makes Gravatar answer with a 404 instead of a generated image for unknown emails.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+emailHash+"?d=404", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch avatar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("baton-fastly: failed to fetch avatar: unexpected status %s", resp.Status)
+	}
+
+	if resp.ContentLength > f.maxSize {
+		return nil, fmt.Errorf("baton-fastly: avatar is larger than %d bytes", f.maxSize)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read avatar: %w", err)
+	}
+
+	if int64(len(data)) > f.maxSize {
+		return nil, fmt.Errorf("baton-fastly: avatar is larger than %d bytes", f.maxSize)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	return &avatar{emailHash: emailHash, contentType: contentType, data: data, fetchedAt: time.Now()}, nil
+}
@@ -0,0 +1,128 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+const (
+	testEmailHash      = "0123456789abcdef0123456789abcdef"
+	testLargeEmailHash = "fedcba9876543210fedcba9876543210"
+	testAvatarMaxSize  = 16
+)
+
+// newTestAvatarServer serves a small PNG for testEmailHash and one larger than testAvatarMaxSize for
+// testLargeEmailHash under /avatar/, and 404 for anything else, like Gravatar does with d=404. It returns
+// the requested paths.
+func newTestAvatarServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mtx sync.Mutex
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		requests = append(requests, r.URL.Path)
+		mtx.Unlock()
+
+		if r.URL.Query().Get("d") != "404" {
+			t.Errorf("avatar requested without d=404: %s", r.URL)
+		}
+
+		switch r.URL.Path {
+		case "/avatar/" + testEmailHash:
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG small"))
+		case "/avatar/" + testLargeEmailHash:
+			// Streamed without a Content-Length, so only reading the body finds out it is too large.
+			w.Header().Set("Content-Type", "image/png")
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(strings.Repeat("x", testAvatarMaxSize+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestAvatarFetch(t *testing.T) {
+	server, requests := newTestAvatarServer(t)
+
+	// The base URL is configured without a trailing slash.
+	fetcher := newAvatarFetcher(server.Client(), server.URL+"/avatar", testAvatarMaxSize)
+
+	tests := []struct {
+		name      string
+		assetId   string
+		wantData  string
+		wantError bool
+	}{
+		{name: "avatar", assetId: avatarAssetPrefix + testEmailHash, wantData: "\x89PNG small"},
+		{name: "cache hit", assetId: avatarAssetPrefix + testEmailHash, wantData: "\x89PNG small"},
+		{name: "larger than the limit", assetId: avatarAssetPrefix + testLargeEmailHash, wantError: true},
+		{name: "malformed email hash", assetId: avatarAssetPrefix + "../admin", wantError: true},
+		{name: "other asset", assetId: "logo:" + testEmailHash, wantError: true},
+		{name: "unknown to gravatar", assetId: avatarAssetPrefix + strings.Repeat("a", 64), wantError: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, body, err := fetcher.fetch(context.Background(), &v2.AssetRef{Id: tt.assetId})
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("fetch succeeded, want error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			data, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.wantData || contentType != "image/png" {
+				t.Errorf("fetch = %q, %q, want %q, image/png", contentType, data, tt.wantData)
+			}
+		})
+	}
+
+	wantRequests := []string{
+		"/avatar/" + testEmailHash,
+		"/avatar/" + testLargeEmailHash,
+		"/avatar/" + strings.Repeat("a", 64),
+	}
+	if got := requests(); strings.Join(got, " ") != strings.Join(wantRequests, " ") {
+		t.Errorf("requests = %q, want %q", got, wantRequests)
+	}
+}
+
+func TestAvatarAssetRef(t *testing.T) {
+	if ref := avatarAssetRef(testEmailHash); ref.GetId() != avatarAssetPrefix+testEmailHash {
+		t.Errorf("avatarAssetRef = %v, want %s%s", ref, avatarAssetPrefix, testEmailHash)
+	}
+
+	for _, emailHash := range []string{"", "not-a-hash", strings.ToUpper(testEmailHash)} {
+		if ref := avatarAssetRef(emailHash); ref != nil {
+			t.Errorf("avatarAssetRef(%q) = %v, want nil", emailHash, ref)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+type backendBuilder struct {
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+	cache         *syncCache
+}
+
+func (o *backendBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return backendResourceType
+}
+
+func newBackendResource(ctx context.Context, backend *fastly.Backend, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":            backend.Name,
+		"service_id":      backend.ServiceID,
+		"service_version": backend.ServiceVersion,
+		"address":         backend.Address,
+		"port":            backend.Port,
+		"use_ssl":         backend.UseSSL,
+		"ssl_check_cert":  backend.SSLCheckCert,
+		"has_client_cert": backend.SSLClientCert != "",
+	}
+
+	optionalFields := map[string]string{
+		"override_host":     backend.OverrideHost,
+		"ssl_cert_hostname": backend.SSLCertHostname,
+		"ssl_sni_hostname":  backend.SSLSNIHostname,
+		"min_tls_version":   backend.MinTLSVersion,
+		"max_tls_version":   backend.MaxTLSVersion,
+		"shield":            backend.Shield,
+		"comment":           backend.Comment,
+	}
+	for key, value := range optionalFields {
+		if value != "" {
+			profile[key] = value
+		}
+	}
+
+	addTimeToProfile(profile, "created_at", backend.CreatedAt)
+	addTimeToProfile(profile, "updated_at", backend.UpdatedAt)
+
+	appTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	resource, err := rs.NewAppResource(
+		backend.Name,
+		backendResourceType,
+		fmt.Sprintf("%s:%s", backend.ServiceID, backend.Name),
+		appTraitOptions,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithDescription(fmt.Sprintf("%s:%d", backend.Address, backend.Port)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns the backends of the active version of the parent service.
+func (o *backendBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	allowed, err := o.serviceFilter.allowsServiceId(o.client, parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error filtering service")
+	}
+
+	if !allowed {
+		return nil, "", nil, nil
+	}
+
+	activeVersion, err := o.cache.activeVersion(parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error getting active service version")
+	}
+
+	if activeVersion == 0 {
+		return nil, "", nil, nil
+	}
+
+	backends, err := o.client.ListBackends(&fastly.ListBackendsInput{
+		ServiceID:      parentResourceID.Resource,
+		ServiceVersion: activeVersion,
+	})
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error listing backends")
+	}
+
+	var resources []*v2.Resource
+	for _, backend := range backends {
+		resource, err := newBackendResource(ctx, backend, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating backend resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+// Entitlements always returns an empty slice for backends.
+func (o *backendBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants always returns an empty slice for backends since they don't have any entitlements.
+func (o *backendBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func newBackendBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter, cache *syncCache) *backendBuilder {
+	return &backendBuilder{
+		resourceType:  backendResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+		cache:         cache,
+	}
+}
@@ -0,0 +1,202 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// BreakGlassRequest is an emergency elevation of a user, either to a role or to full access on services.
+type BreakGlassRequest struct {
+	// Account is the name of the account from WithAccountTokens, empty when only one account is synced.
+	Account string
+	// User is the ID or login of the user to elevate.
+	User     string
+	Role     string
+	Services []string
+	Reason   string
+	Duration time.Duration
+	// Operator is who asked for the elevation, for the audit file.
+	Operator string
+}
+
+// BreakGlass elevates the user through the role and service provisioning, as time-bound grants that are
+// rolled back once the duration has passed. Every elevation is appended to the audit file before it is
+// granted, and so is its outcome, whether it succeeds or not. It returns the time the elevation expires at,
+// as stored in the grant state file, which is later than the requested duration when the user was already
+// elevated for longer.
+func (d *Fastly) BreakGlass(ctx context.Context, req *BreakGlassRequest) (time.Time, error) {
+	l := ctxzap.Extract(ctx)
+
+	if strings.TrimSpace(req.Reason) == "" {
+		return time.Time{}, fmt.Errorf("baton-fastly: a reason is required to break glass")
+	}
+
+	if req.Duration <= 0 {
+		return time.Time{}, fmt.Errorf("baton-fastly: break glass duration must be positive")
+	}
+
+	if (req.Role == "") == (len(req.Services) == 0) {
+		return time.Time{}, fmt.Errorf("baton-fastly: break glass needs either a role or services")
+	}
+
+	if d.grants == nil || d.audit == nil {
+		return time.Time{}, fmt.Errorf("baton-fastly: a grant state file and an audit file are required to break glass")
+	}
+
+	a, err := d.account(req.Account)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	user, err := findUser(a.client, a.customerId, req.User)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	principal, err := newUserResource(ctx, user, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	grants := d.grants.withDuration(req.Duration)
+	requestedExpiresAt := time.Now().UTC().Add(req.Duration)
+
+	var expiresAt time.Time
+	entry := auditEntry{
+		Operator:   req.Operator,
+		CustomerID: a.customerId,
+		UserID:     user.ID,
+		Login:      user.Login,
+		Reason:     req.Reason,
+		DryRun:     d.dryRun,
+	}
+
+	if req.Role != "" {
+		e := entry
+
+		roleId := req.Role
+		key := elevationKey(a.customerId, elevationKindIAMRole, user.ID, roleId)
+		if legacyRole, ok := legacyRoleName(roleId); ok {
+			roleId = legacyRole
+			key = elevationKey(a.customerId, elevationKindRole, user.ID, "")
+			e.Previous = user.Role
+		}
+		e.Role = roleId
+
+		if err := d.auditBreakGlassRequest(&e, requestedExpiresAt); err != nil {
+			return time.Time{}, err
+		}
+
+		roles := newRoleBuilder(a.client, a.customerId, d.dryRun, grants)
+		role := &v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: roleId}}
+
+		_, err := roles.Grant(ctx, principal, ent.NewAssignmentEntitlement(role, assignedEntitlement))
+		if err == nil {
+			e.ExpiresAt, err = grants.expiresAt(key, requestedExpiresAt)
+		}
+		if err := d.auditBreakGlass(l, &e, err); err != nil {
+			return time.Time{}, err
+		}
+
+		expiresAt = latest(expiresAt, *e.ExpiresAt)
+	}
+
+	services := newServiceBuilder(a.client, a.customerId, d.serviceFilter, d.dryRun, grants, newSyncCache(a.client, a.customerId))
+	for _, serviceId := range req.Services {
+		service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: serviceId}}
+
+		e := entry
+		e.ServiceID = serviceId
+		e.Permission = FullAccessPermission
+
+		if err := d.auditBreakGlassRequest(&e, requestedExpiresAt); err != nil {
+			return time.Time{}, err
+		}
+
+		_, err := services.Grant(ctx, principal, ent.NewAssignmentEntitlement(service, fullAccessEntitlement))
+		if err == nil {
+			e.ExpiresAt, err = grants.expiresAt(elevationKey(a.customerId, elevationKindService, user.ID, serviceId), requestedExpiresAt)
+		}
+		if err := d.auditBreakGlass(l, &e, err); err != nil {
+			return time.Time{}, err
+		}
+
+		expiresAt = latest(expiresAt, *e.ExpiresAt)
+	}
+
+	return expiresAt, nil
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
+
+// auditBreakGlassRequest appends a break glass grant to the audit file before it is made, so that the audit
+// file holds every elevation even if the connector stops before its outcome is known. Nothing is granted when
+// the audit file can not be written.
+func (d *Fastly) auditBreakGlassRequest(e *auditEntry, requestedExpiresAt time.Time) error {
+	request := *e
+	request.Event = auditEventBreakGlassRequested
+	request.ExpiresAt = &requestedExpiresAt
+
+	return d.audit.append(&request)
+}
+
+// auditBreakGlass appends the outcome of a break glass grant to the audit file. It returns the error of
+// the grant, if any, or else the error of the audit file.
+func (d *Fastly) auditBreakGlass(l *zap.Logger, e *auditEntry, grantErr error) error {
+	if grantErr != nil {
+		e.Event = auditEventBreakGlassFailed
+		e.Error = grantErr.Error()
+		if err := d.audit.append(e); err != nil {
+			l.Error("baton-fastly: failed to audit break glass", zap.Error(err))
+		}
+
+		return grantErr
+	}
+
+	e.Event = auditEventBreakGlass
+	if err := d.audit.append(e); err != nil {
+		return err
+	}
+
+	l.Warn(
+		"baton-fastly: broke glass",
+		zap.String("user_id", e.UserID),
+		zap.String("role", e.Role),
+		zap.String("service_id", e.ServiceID),
+		zap.String("reason", e.Reason),
+		zap.Timep("expires_at", e.ExpiresAt),
+		zap.Bool("dry_run", e.DryRun),
+	)
+
+	return nil
+}
+
+// findUser returns the user of the account with the ID or login.
+func findUser(client *fastly.Client, customerId, idOrLogin string) (*fastly.User, error) {
+	users, err := client.ListCustomerUsers(&fastly.ListCustomerUsersInput{CustomerID: customerId})
+	if err != nil {
+		return nil, wrapError(err, "error listing users")
+	}
+
+	for _, user := range users {
+		if user.ID == idOrLogin || strings.EqualFold(user.Login, idOrLogin) {
+			return user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("baton-fastly: unknown user %q", idOrLogin)
+}
@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// auditEvents returns the events of the audit file, in order.
+func auditEvents(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var rv []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		rv = append(rv, entry.Event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return rv
+}
+
+func newBreakGlassTestConnector(t *testing.T, auditPath string) (*fakeFastly, *Fastly) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.addUser("u-alice", "alice", "engineer")
+
+	d := &Fastly{
+		accounts: []*account{{client: f.client(), customerId: "cust"}},
+		grants:   newTestTimeBoundGrants(t),
+		audit:    newAuditLog(auditPath),
+	}
+
+	return f, d
+}
+
+func TestBreakGlassAudit(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    *BreakGlassRequest
+		failure    string
+		wantEvents []string
+	}{
+		{
+			name:       "role",
+			request:    &BreakGlassRequest{User: "alice", Role: superUserRole},
+			wantEvents: []string{auditEventBreakGlassRequested, auditEventBreakGlass},
+		},
+		{
+			name:       "services",
+			request:    &BreakGlassRequest{User: "alice", Services: []string{"svc-a"}},
+			wantEvents: []string{auditEventBreakGlassRequested, auditEventBreakGlass},
+		},
+		{
+			name:       "failed role",
+			request:    &BreakGlassRequest{User: "alice", Role: superUserRole},
+			failure:    http.MethodPut + " /user/u-alice",
+			wantEvents: []string{auditEventBreakGlassRequested, auditEventBreakGlassFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+			f, d := newBreakGlassTestConnector(t, auditPath)
+			if tt.failure != "" {
+				f.failures[tt.failure] = http.StatusInternalServerError
+			}
+
+			tt.request.Reason = "outage"
+			tt.request.Duration = time.Hour
+
+			_, err := d.BreakGlass(context.Background(), tt.request)
+			if (err != nil) != (tt.failure != "") {
+				t.Fatalf("BreakGlass() = %v, want error %v", err, tt.failure != "")
+			}
+
+			if got := auditEvents(t, auditPath); !reflect.DeepEqual(got, tt.wantEvents) {
+				t.Errorf("audit events = %q, want %q", got, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestBreakGlassWithoutAuditFile(t *testing.T) {
+	f, d := newBreakGlassTestConnector(t, filepath.Join(t.TempDir(), "missing", "audit.jsonl"))
+
+	_, err := d.BreakGlass(context.Background(), &BreakGlassRequest{User: "alice", Role: superUserRole, Reason: "outage", Duration: time.Hour})
+	if err == nil {
+		t.Fatal("BreakGlass succeeded without an audit file")
+	}
+
+	if role := f.user("u-alice").role; role != "engineer" {
+		t.Errorf("role = %q, want engineer", role)
+	}
+}
@@ -2,63 +2,574 @@ package connector
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/fastly/go-fastly/v8/fastly"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type Fastly struct {
-	client *fastly.Client
+	accounts []*account
 
-	customerId string
+	// accountTokens are the named access tokens of the accounts to sync. When they are set,
+	// resource IDs are namespaced by the customer ID of their account.
+	accountTokens map[string]string
+	namespaced    bool
+
+	accessTokenFile    string
+	accessTokenCommand string
+
+	inviteAccounts              bool
+	serviceAccountLoginPatterns []string
+	activityLookback            time.Duration
+	avatarBaseURL               string
+	avatarMaxSize               int64
+	avatars                     *avatarFetcher
+
+	enabledResourceTypes  []string
+	disabledResourceTypes []string
+
+	includeServices []string
+	excludeServices []string
+	serviceTypes    []string
+	serviceFilter   *serviceFilter
+
+	transport  transportConfig
+	httpClient *http.Client
+
+	readOnly bool
+	dryRun   bool
+
+	grantDurations map[string]time.Duration
+	grantStateFile string
+	grants         *timeBoundGrants
+
+	auditFile string
+	audit     *auditLog
+}
+
+// Option configures optional behavior of the connector.
+type Option func(*Fastly)
+
+// WithAccessTokenFile reads the access token from a file, which is re-read whenever it changes.
+func WithAccessTokenFile(path string) Option {
+	return func(d *Fastly) {
+		d.accessTokenFile = path
+	}
+}
+
+// WithAccessTokenCommand gets the access token from the output of a shell command, which is run
+// again whenever the API rejects the token.
+func WithAccessTokenCommand(command string) Option {
+	return func(d *Fastly) {
+		d.accessTokenCommand = command
+	}
+}
+
+// WithProxyURL sends all requests through the HTTP proxy. Credentials of an authenticating proxy
+// are part of the URL.
+func WithProxyURL(proxyURL string) Option {
+	return func(d *Fastly) {
+		d.transport.proxyURL = proxyURL
+	}
+}
+
+// WithCABundle trusts the certificates of the PEM encoded CA bundle in addition to the system ones,
+// e.g. for proxies that re-sign TLS with an internal CA.
+func WithCABundle(path string) Option {
+	return func(d *Fastly) {
+		d.transport.caBundle = path
+	}
+}
+
+// WithClientCertificate authenticates TLS connections with the client certificate.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(d *Fastly) {
+		d.transport.clientCertFile = certFile
+		d.transport.clientKeyFile = keyFile
+	}
+}
+
+// WithReadOnly refuses every request that would change something in Fastly, so that the connector can
+// only sync even if provisioning is enabled.
+func WithReadOnly(readOnly bool) Option {
+	return func(d *Fastly) {
+		d.readOnly = readOnly
+	}
+}
+
+// WithDryRun makes role and service grants and revokes return the Fastly API calls they would make,
+// as annotations and log lines, instead of making them.
+func WithDryRun(dryRun bool) Option {
+	return func(d *Fastly) {
+		d.dryRun = dryRun
+	}
+}
+
+// WithGrantDurations makes grants of roles and service permissions expire after a duration. The keys are
+// service entitlements, e.g. "purge-all", role IDs prefixed with "role:", e.g. "role:Superuser", or
+// AnyEntitlement for all of them. Expired grants are reverted to the role or permission held before them.
+func WithGrantDurations(durations map[string]time.Duration) Option {
+	return func(d *Fastly) {
+		d.grantDurations = durations
+	}
+}
+
+// WithGrantStateFile sets the file that time-bound grants, and the state before each of them, are kept in.
+func WithGrantStateFile(path string) Option {
+	return func(d *Fastly) {
+		d.grantStateFile = path
+	}
+}
+
+// WithAuditFile sets the file that break glass elevations, and the rollback of every expired grant, are
+// appended to.
+func WithAuditFile(path string) Option {
+	return func(d *Fastly) {
+		d.auditFile = path
+	}
+}
+
+// WithInviteAccounts makes CreateAccount send an invitation instead of creating the user directly.
+func WithInviteAccounts(inviteAccounts bool) Option {
+	return func(d *Fastly) {
+		d.inviteAccounts = inviteAccounts
+	}
+}
+
+// WithAccountTokens makes the connector sync several accounts, one for each named access token.
+func WithAccountTokens(tokens map[string]string) Option {
+	return func(d *Fastly) {
+		d.accountTokens = tokens
+	}
+}
+
+// WithServiceAccountLoginPatterns sets the glob patterns of logins that belong to service accounts.
+func WithServiceAccountLoginPatterns(patterns []string) Option {
+	return func(d *Fastly) {
+		d.serviceAccountLoginPatterns = patterns
+	}
+}
+
+// WithActivityLookback sets how far back the event log is scanned for the last activity of users.
+func WithActivityLookback(lookback time.Duration) Option {
+	return func(d *Fastly) {
+		d.activityLookback = lookback
+	}
+}
+
+// WithAvatarBaseURL sets the URL user avatars are fetched from, instead of Gravatar.
+func WithAvatarBaseURL(baseURL string) Option {
+	return func(d *Fastly) {
+		d.avatarBaseURL = baseURL
+	}
+}
+
+// WithAvatarMaxSize sets the largest avatar, in bytes, that Asset serves.
+func WithAvatarMaxSize(maxSize int64) Option {
+	return func(d *Fastly) {
+		d.avatarMaxSize = maxSize
+	}
+}
+
+// WithResourceTypes limits the sync to the given resource types. All resource types are synced by default.
+func WithResourceTypes(resourceTypes []string) Option {
+	return func(d *Fastly) {
+		d.enabledResourceTypes = resourceTypes
+	}
+}
+
+// WithoutResourceTypes excludes the given resource types from the sync.
+func WithoutResourceTypes(resourceTypes []string) Option {
+	return func(d *Fastly) {
+		d.disabledResourceTypes = resourceTypes
+	}
+}
+
+// WithServiceFilter limits the services, and the resources belonging to them, that are synced. Services
+// are included when they match one of the include patterns, if any, and none of the exclude patterns.
+// A pattern matches the ID of a service or is a glob of its name, or, prefixed with "re:", a regular
+// expression of its name. Service types limits the services to vcl or wasm services.
+func WithServiceFilter(include, exclude, serviceTypes []string) Option {
+	return func(d *Fastly) {
+		d.includeServices = include
+		d.excludeServices = exclude
+		d.serviceTypes = serviceTypes
+	}
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
 func (d *Fastly) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
-		newUserBuilder(d.client, d.customerId),
-		newServiceBuilder(d.client, d.customerId),
-		newRoleBuilder(d.client, d.customerId),
+	if !d.namespaced {
+		return d.accountResourceSyncers(ctx, d.accounts[0])
+	}
+
+	perAccount := make([][]connectorbuilder.ResourceSyncer, 0, len(d.accounts))
+	for _, account := range d.accounts {
+		perAccount = append(perAccount, d.accountResourceSyncers(ctx, account))
 	}
+
+	var rv []connectorbuilder.ResourceSyncer
+	for i := range perAccount[0] {
+		syncers := make([]connectorbuilder.ResourceSyncer, 0, len(perAccount))
+		for _, accountSyncers := range perAccount {
+			syncers = append(syncers, accountSyncers[i])
+		}
+
+		rv = append(rv, newNamespacedSyncer(ctx, d.accounts, syncers))
+	}
+
+	return rv
+}
+
+func (d *Fastly) accountResourceSyncers(ctx context.Context, a *account) []connectorbuilder.ResourceSyncer {
+	cache := newSyncCache(a.client, a.customerId)
+
+	syncers := []connectorbuilder.ResourceSyncer{
+		newAccountBuilder(a.client, a.customerId, a.name),
+		newUserBuilder(a.client, a.customerId, d.serviceAccountLoginPatterns, d.activityLookback),
+		newServiceBuilder(a.client, a.customerId, d.serviceFilter, d.dryRun, d.grants, cache),
+		newServiceVersionBuilder(a.client, a.customerId, d.serviceFilter),
+		newDomainBuilder(a.client, a.customerId, d.serviceFilter, cache),
+		newBackendBuilder(a.client, a.customerId, d.serviceFilter, cache),
+		newLoggingEndpointBuilder(a.client, a.customerId, d.serviceFilter, cache),
+		newACLBuilder(a.client, a.customerId, d.serviceFilter, cache),
+		newDictionaryBuilder(a.client, a.customerId, d.serviceFilter, cache),
+		newRoleBuilder(a.client, a.customerId, d.dryRun, d.grants),
+		newUserGroupBuilder(a.client, a.customerId, d.serviceFilter),
+		newServiceGroupBuilder(a.client, a.customerId, d.serviceFilter),
+		newInvitationBuilder(a.client, a.customerId),
+	}
+
+	var rv []connectorbuilder.ResourceSyncer
+	for _, syncer := range syncers {
+		if d.isResourceTypeEnabled(syncer.ResourceType(ctx).Id) {
+			rv = append(rv, syncer)
+		}
+	}
+
+	return rv
+}
+
+func (d *Fastly) isResourceTypeEnabled(resourceTypeId string) bool {
+	if len(d.enabledResourceTypes) > 0 && !containsString(d.enabledResourceTypes, resourceTypeId) {
+		return false
+	}
+
+	return !containsString(d.disabledResourceTypes, resourceTypeId)
+}
+
+// validateResourceTypes returns an error for unknown resource types in the enabled and disabled ones.
+func (d *Fastly) validateResourceTypes() error {
+	known := make([]string, 0, len(allResourceTypes))
+	for _, resourceType := range allResourceTypes {
+		known = append(known, resourceType.Id)
+	}
+
+	for _, resourceTypeId := range append(append([]string{}, d.enabledResourceTypes...), d.disabledResourceTypes...) {
+		if !containsString(known, resourceTypeId) {
+			return fmt.Errorf("baton-fastly: unknown resource type %q, must be one of %s", resourceTypeId, strings.Join(known, ", "))
+		}
+	}
+
+	return nil
+}
+
+// account returns the account with the given name. The name can be left empty when only one account is synced.
+func (d *Fastly) account(name string) (*account, error) {
+	if name == "" && len(d.accounts) == 1 {
+		return d.accounts[0], nil
+	}
+
+	for _, account := range d.accounts {
+		if account.name == name {
+			return account, nil
+		}
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("baton-fastly: an account name is required when syncing several accounts")
+	}
+
+	return nil, fmt.Errorf("baton-fastly: unknown account %q", name)
 }
 
 // Asset takes an input AssetRef and attempts to fetch it using the connector's authenticated http client
 // It streams a response, always starting with a metadata object, following by chunked payloads for the asset.
 func (d *Fastly) Asset(ctx context.Context, asset *v2.AssetRef) (string, io.ReadCloser, error) {
-	return "", nil, nil
+	return d.avatars.fetch(ctx, asset)
 }
 
-// Metadata returns metadata about the connector.
+// Metadata returns metadata about the connector, including the security settings of the account and
+// whether the connector is read-only. When several accounts are synced, the settings of each are published
+// under its name.
 func (d *Fastly) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error) {
+	var profile map[string]interface{}
+	accountProfiles := make(map[string]interface{}, len(d.accounts))
+
+	for _, account := range d.accounts {
+		customer, err := getCustomer(account.client, account.customerId)
+		if err != nil {
+			return nil, wrapError(err, "failed to get account security settings")
+		}
+
+		profile = customer.securityProfile()
+		if d.namespaced {
+			profile["customer_id"] = account.customerId
+			accountProfiles[account.name] = profile
+		}
+	}
+
+	if d.namespaced {
+		profile = map[string]interface{}{"accounts": accountProfiles}
+	}
+
+	profile["read_only"] = d.readOnly
+
+	metadataProfile, err := structpb.NewStruct(profile)
+	if err != nil {
+		return nil, wrapError(err, "failed to create metadata profile")
+	}
+
 	return &v2.ConnectorMetadata{
 		DisplayName: "Fastly",
 		Description: "Connector syncing Fastly resources to Baton",
+		Profile:     metadataProfile,
 	}, nil
 }
 
-// Validate is called to ensure that the connector is properly configured. It should exercise any API credentials
-// to be sure that they are valid.
+// Validate is called to ensure that the connector is properly configured. It checks that the token of
+// every account is still valid, and reports whether the connector is read-only.
 func (d *Fastly) Validate(ctx context.Context) (annotations.Annotations, error) {
-	return nil, nil
+	l := ctxzap.Extract(ctx)
+
+	for _, account := range d.accounts {
+		_, err := account.client.GetCurrentUser()
+		if err != nil {
+			return nil, wrapError(err, fmt.Sprintf("failed to validate token of account %s", account.customerId))
+		}
+	}
+
+	mode, err := structpb.NewStruct(map[string]interface{}{"read_only": d.readOnly})
+	if err != nil {
+		return nil, err
+	}
+
+	if d.readOnly {
+		l.Info("baton-fastly: connector is read-only, all changes to Fastly are refused")
+	}
+
+	var annos annotations.Annotations
+	annos.Append(mode)
+
+	return annos, nil
 }
 
-// New returns a new instance of the connector.
-func New(ctx context.Context, accessToken string) (*Fastly, error) {
+// CreateAccount provisions a new account with the given role in the named Fastly account. Depending on the
+// connector options it either creates the user directly or sends an invitation that the user has to accept.
+func (d *Fastly) CreateAccount(ctx context.Context, accountName, email, name, role string) (*v2.Resource, error) {
+	a, err := d.account(accountName)
+	if err != nil {
+		return nil, err
+	}
+
+	legacyRole, ok := legacyUserRoleValue(role)
+	if !ok {
+		return nil, fmt.Errorf("baton-fastly: accounts can only be created with one of the roles %s", strings.Join(roles, ", "))
+	}
+
+	resource, err := d.createAccount(ctx, a, email, name, legacyRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.namespaced {
+		resource = namespaceResource(a.customerId, resource)
+	}
+
+	return resource, nil
+}
+
+func (d *Fastly) createAccount(ctx context.Context, a *account, email, name, role string) (*v2.Resource, error) {
+	if d.inviteAccounts {
+		invitation, err := createInvitation(a.client, a.customerId, email, role)
+		if err != nil {
+			return nil, wrapError(err, "failed to create invitation")
+		}
+
+		return newInvitationResource(ctx, *invitation)
+	}
+
+	user, err := a.client.CreateUser(&fastly.CreateUserInput{
+		Login: &email,
+		Name:  &name,
+		Role:  &role,
+	})
+	if err != nil {
+		return nil, wrapError(err, "failed to create user")
+	}
+
+	return newUserResource(ctx, user, nil)
+}
+
+// newClient creates a Fastly API client for the access token that uses the connector's HTTP client.
+func (d *Fastly) newClient(accessToken string) (*fastly.Client, error) {
 	client, err := fastly.NewClient(accessToken)
 	if err != nil {
 		return nil, err
 	}
 
+	client.HTTPClient = d.httpClient
+
+	return client, nil
+}
+
+// newAccount looks up the customer the client's token belongs to.
+func newAccount(name string, client *fastly.Client) (*account, error) {
 	user, err := client.GetCurrentUser()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Fastly{
+	return &account{
+		name:       name,
 		client:     client,
 		customerId: user.CustomerID,
+		userId:     user.ID,
 	}, nil
 }
+
+// New returns a new instance of the connector. It syncs the account of the access token, or of the
+// token from WithAccessTokenFile or WithAccessTokenCommand, or, when WithAccountTokens is used instead,
+// every named account.
+func New(ctx context.Context, accessToken string, opts ...Option) (*Fastly, error) {
+	d := &Fastly{
+		activityLookback: DefaultActivityLookback,
+		avatarBaseURL:    DefaultAvatarBaseURL,
+		avatarMaxSize:    DefaultAvatarMaxSize,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	err := validateServiceAccountLoginPatterns(d.serviceAccountLoginPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.activityLookback <= 0 {
+		return nil, fmt.Errorf("baton-fastly: activity lookback must be positive")
+	}
+
+	if d.avatarMaxSize <= 0 {
+		return nil, fmt.Errorf("baton-fastly: avatar max size must be positive")
+	}
+
+	err = d.validateResourceTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	d.serviceFilter, err = newServiceFilter(d.includeServices, d.excludeServices, d.serviceTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	d.grants, err = newTimeBoundGrants(d.grantDurations, d.grantStateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	d.audit = newAuditLog(d.auditFile)
+	if d.grants != nil {
+		d.grants.audit = d.audit
+	}
+
+	d.httpClient, err = d.transport.newHTTPClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.readOnly {
+		d.httpClient.Transport = &readOnlyTransport{base: d.httpClient.Transport}
+	}
+
+	credentials := 0
+	for _, set := range []bool{accessToken != "", d.accessTokenFile != "", d.accessTokenCommand != "", len(d.accountTokens) > 0} {
+		if set {
+			credentials++
+		}
+	}
+
+	if credentials > 1 {
+		return nil, fmt.Errorf("baton-fastly: only one of access token, access token file, access token command and account tokens can be used")
+	}
+
+	var client *fastly.Client
+	switch {
+	case accessToken != "":
+		client, err = d.newClient(accessToken)
+	case d.accessTokenFile != "":
+		client, err = newRotatingClient(&fileTokenSource{path: d.accessTokenFile}, d.httpClient)
+	case d.accessTokenCommand != "":
+		client, err = newRotatingClient(&commandTokenSource{command: d.accessTokenCommand}, d.httpClient)
+	case len(d.accountTokens) > 0:
+		d.namespaced = true
+	default:
+		return nil, fmt.Errorf("baton-fastly: an access token is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client != nil {
+		account, err := newAccount("", client)
+		if err != nil {
+			return nil, err
+		}
+
+		d.accounts = append(d.accounts, account)
+	}
+
+	if d.namespaced {
+		names := make([]string, 0, len(d.accountTokens))
+		for name := range d.accountTokens {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		customerIds := make(map[string]string)
+		for _, name := range names {
+			client, err := d.newClient(d.accountTokens[name])
+			if err != nil {
+				return nil, err
+			}
+
+			account, err := newAccount(name, client)
+			if err != nil {
+				return nil, fmt.Errorf("baton-fastly: failed to set up account %q: %w", name, err)
+			}
+
+			if other, ok := customerIds[account.customerId]; ok {
+				return nil, fmt.Errorf("baton-fastly: accounts %q and %q belong to the same customer", other, name)
+			}
+			customerIds[account.customerId] = name
+
+			d.accounts = append(d.accounts, account)
+		}
+	}
+
+	d.avatars = newAvatarFetcher(d.httpClient, d.avatarBaseURL, d.avatarMaxSize)
+
+	return d, nil
+}
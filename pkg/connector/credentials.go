@@ -0,0 +1,203 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+// tokenSource provides the current Fastly API token of a rotating credential.
+type tokenSource interface {
+	// token returns the current token, re-reading it if it is known to have changed.
+	token() (string, error)
+	// refresh re-reads the token unconditionally, e.g. after the API rejected the current one.
+	refresh() (string, error)
+}
+
+// fileTokenSource reads the token from a file and re-reads it whenever the file is modified.
+type fileTokenSource struct {
+	path string
+
+	mu      sync.Mutex
+	current string
+	modTime time.Time
+}
+
+func (s *fileTokenSource) token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if s.current != "" {
+			// Keep using the last token while the file is being replaced.
+			return s.current, nil
+		}
+
+		return "", fmt.Errorf("baton-fastly: failed to read access token file: %w", err)
+	}
+
+	if s.current != "" && info.ModTime().Equal(s.modTime) {
+		return s.current, nil
+	}
+
+	return s.read(info.ModTime())
+}
+
+func (s *fileTokenSource) refresh() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", fmt.Errorf("baton-fastly: failed to read access token file: %w", err)
+	}
+
+	return s.read(info.ModTime())
+}
+
+func (s *fileTokenSource) read(modTime time.Time) (string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("baton-fastly: failed to read access token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("baton-fastly: access token file %s is empty", s.path)
+	}
+
+	s.current = token
+	s.modTime = modTime
+
+	return token, nil
+}
+
+// commandTokenSource runs a command that prints the token, e.g. a secret manager CLI. The command is
+// only run again when the API rejects the token.
+type commandTokenSource struct {
+	command string
+
+	mu      sync.Mutex
+	current string
+}
+
+const accessTokenCommandTimeout = 30 * time.Second
+
+func (s *commandTokenSource) token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current != "" {
+		return s.current, nil
+	}
+
+	return s.run()
+}
+
+func (s *commandTokenSource) refresh() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.run()
+}
+
+func (s *commandTokenSource) run() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), accessTokenCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("baton-fastly: access token command failed: %w", err)
+	}
+
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("baton-fastly: access token command printed no token")
+	}
+
+	s.current = token
+
+	return token, nil
+}
+
+// rotatingTransport replaces the API key of every Fastly API request with the current token of the
+// source, and retries a request once with a re-read token when the API answers 401.
+type rotatingTransport struct {
+	base   http.RoundTripper
+	source tokenSource
+}
+
+func (t *rotatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only requests to the Fastly API carry the key; anything else, like avatars, is passed through.
+	if req.Header.Get(fastly.APIKeyHeader) == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	token, err := t.source.token()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(withAPIKey(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	refreshed, err := t.source.refresh()
+	if err != nil || refreshed == token {
+		return resp, nil
+	}
+
+	retry := withAPIKey(req, refreshed)
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+	}
+
+	resp.Body.Close()
+
+	return t.base.RoundTrip(retry)
+}
+
+func withAPIKey(req *http.Request, token string) *http.Request {
+	rv := req.Clone(req.Context())
+	rv.Header.Set(fastly.APIKeyHeader, token)
+
+	return rv
+}
+
+// newRotatingClient creates a client whose API key follows the token source.
+func newRotatingClient(source tokenSource, httpClient *http.Client) (*fastly.Client, error) {
+	token, err := source.token()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := fastly.NewClient(token)
+	if err != nil {
+		return nil, err
+	}
+
+	client.HTTPClient = &http.Client{
+		Transport: &rotatingTransport{base: httpClient.Transport, source: source},
+	}
+
+	return client, nil
+}
@@ -0,0 +1,148 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+type dictionaryBuilder struct {
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+	cache         *syncCache
+}
+
+func (o *dictionaryBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return dictionaryResourceType
+}
+
+func newDictionaryResource(ctx context.Context, dictionary *fastly.Dictionary, info *fastly.DictionaryInfo, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"id":              dictionary.ID,
+		"name":            dictionary.Name,
+		"service_id":      dictionary.ServiceID,
+		"service_version": dictionary.ServiceVersion,
+		"write_only":      dictionary.WriteOnly,
+		"item_count":      info.ItemCount,
+	}
+
+	addTimeToProfile(profile, "created_at", dictionary.CreatedAt)
+	addTimeToProfile(profile, "updated_at", dictionary.UpdatedAt)
+	addTimeToProfile(profile, "items_updated_at", info.LastUpdated)
+
+	appTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	resource, err := rs.NewAppResource(
+		dictionary.Name,
+		dictionaryResourceType,
+		dictionary.ID,
+		appTraitOptions,
+		rs.WithParentResourceID(parentResourceID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns the edge dictionaries of the active version of the parent service.
+func (o *dictionaryBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	allowed, err := o.serviceFilter.allowsServiceId(o.client, parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error filtering service")
+	}
+
+	if !allowed {
+		return nil, "", nil, nil
+	}
+
+	activeVersion, err := o.cache.activeVersion(parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error getting active service version")
+	}
+
+	if activeVersion == 0 {
+		return nil, "", nil, nil
+	}
+
+	dictionaries, err := o.client.ListDictionaries(&fastly.ListDictionariesInput{
+		ServiceID:      parentResourceID.Resource,
+		ServiceVersion: activeVersion,
+	})
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error listing dictionaries")
+	}
+
+	if len(dictionaries) == 0 {
+		return nil, "", nil, nil
+	}
+
+	var resources []*v2.Resource
+	for _, dictionary := range dictionaries {
+		info, err := o.client.GetDictionaryInfo(&fastly.GetDictionaryInfoInput{
+			ID:             dictionary.ID,
+			ServiceID:      dictionary.ServiceID,
+			ServiceVersion: activeVersion,
+		})
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error getting dictionary info")
+		}
+
+		resource, err := newDictionaryResource(ctx, dictionary, info, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating dictionary resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *dictionaryBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+
+	assigmentOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(userResourceType),
+		ent.WithDescription(fmt.Sprintf("Manage items of %s dictionary", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s of %s", manageEntriesEntitlement, resource.DisplayName)),
+	}
+	rv = append(rv, ent.NewAssignmentEntitlement(resource, manageEntriesEntitlement, assigmentOptions...))
+
+	return rv, "", nil, nil
+}
+
+// Grants returns a manage-entries grant for every user that can modify the parent service.
+func (o *dictionaryBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	rv, err := grantManageEntries(o.cache, resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "failed to create manage-entries grants")
+	}
+
+	return rv, "", nil, nil
+}
+
+func newDictionaryBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter, cache *syncCache) *dictionaryBuilder {
+	return &dictionaryBuilder{
+		resourceType:  dictionaryResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+		cache:         cache,
+	}
+}
@@ -0,0 +1,121 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+type domainBuilder struct {
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+	cache         *syncCache
+}
+
+func (o *domainBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return domainResourceType
+}
+
+func newDomainResource(ctx context.Context, domain *fastly.Domain, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":            domain.Name,
+		"service_id":      domain.ServiceID,
+		"service_version": domain.ServiceVersion,
+	}
+
+	if domain.Comment != "" {
+		profile["comment"] = domain.Comment
+	}
+
+	addTimeToProfile(profile, "created_at", domain.CreatedAt)
+	addTimeToProfile(profile, "updated_at", domain.UpdatedAt)
+
+	appTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	resource, err := rs.NewAppResource(
+		domain.Name,
+		domainResourceType,
+		fmt.Sprintf("%s:%s", domain.ServiceID, domain.Name),
+		appTraitOptions,
+		rs.WithParentResourceID(parentResourceID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns the domains of the active version of the parent service.
+func (o *domainBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	allowed, err := o.serviceFilter.allowsServiceId(o.client, parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error filtering service")
+	}
+
+	if !allowed {
+		return nil, "", nil, nil
+	}
+
+	activeVersion, err := o.cache.activeVersion(parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error getting active service version")
+	}
+
+	if activeVersion == 0 {
+		return nil, "", nil, nil
+	}
+
+	domains, err := o.client.ListDomains(&fastly.ListDomainsInput{
+		ServiceID:      parentResourceID.Resource,
+		ServiceVersion: activeVersion,
+	})
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error listing domains")
+	}
+
+	var resources []*v2.Resource
+	for _, domain := range domains {
+		resource, err := newDomainResource(ctx, domain, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating domain resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+// Entitlements always returns an empty slice for domains.
+func (o *domainBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants always returns an empty slice for domains since they don't have any entitlements.
+func (o *domainBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func newDomainBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter, cache *syncCache) *domainBuilder {
+	return &domainBuilder{
+		resourceType:  domainResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+		cache:         cache,
+	}
+}
@@ -0,0 +1,193 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+const (
+	driftAdded   = "added"
+	driftRemoved = "removed"
+	driftChanged = "changed"
+)
+
+// DriftResourceTypes are the resource types whose grants to users are compared by drift detection: the
+// roles of users and their permissions on services.
+var DriftResourceTypes = []string{roleResourceType.Id, serviceResourceType.Id}
+
+// GrantDrift is the difference between the entitlements a user had on a resource in a snapshot and the
+// ones the user has now.
+type GrantDrift struct {
+	Change        string   `json:"change"`
+	ResourceType  string   `json:"resource_type"`
+	ResourceID    string   `json:"resource_id"`
+	PrincipalType string   `json:"principal_type"`
+	PrincipalID   string   `json:"principal_id"`
+	Before        []string `json:"before"`
+	After         []string `json:"after"`
+}
+
+// DriftReport lists the grants that were added, removed or changed since a snapshot.
+type DriftReport struct {
+	Snapshot string       `json:"snapshot,omitempty"`
+	SyncID   string       `json:"sync_id,omitempty"`
+	Added    int          `json:"added"`
+	Removed  int          `json:"removed"`
+	Changed  int          `json:"changed"`
+	Drift    []GrantDrift `json:"drift"`
+}
+
+// HasDrift returns true when anything changed since the snapshot.
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Drift) > 0
+}
+
+// LiveGrants returns the current grants of the DriftResourceTypes, read through their resource syncers.
+func (d *Fastly) LiveGrants(ctx context.Context) ([]*v2.Grant, error) {
+	for _, resourceTypeId := range DriftResourceTypes {
+		if !d.isResourceTypeEnabled(resourceTypeId) {
+			return nil, fmt.Errorf("baton-fastly: resource type %q is needed to detect drift but is not synced", resourceTypeId)
+		}
+	}
+
+	var rv []*v2.Grant
+	for _, syncer := range d.ResourceSyncers(ctx) {
+		if !containsString(DriftResourceTypes, syncer.ResourceType(ctx).Id) {
+			continue
+		}
+
+		resources, err := listAllResources(ctx, syncer)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, resource := range resources {
+			grants, err := listAllGrants(ctx, syncer, resource)
+			if err != nil {
+				return nil, err
+			}
+
+			rv = append(rv, grants...)
+		}
+	}
+
+	return rv, nil
+}
+
+// driftKey identifies a principal on a resource.
+type driftKey struct {
+	resourceType  string
+	resourceId    string
+	principalType string
+	principalId   string
+}
+
+// groupDriftGrants returns the entitlements granted to users on the DriftResourceTypes, by resource and user.
+func groupDriftGrants(grants []*v2.Grant) map[driftKey][]string {
+	rv := make(map[driftKey][]string)
+
+	for _, g := range grants {
+		resourceId := g.GetEntitlement().GetResource().GetId()
+		principalId := g.GetPrincipal().GetId()
+		if resourceId == nil || principalId == nil {
+			continue
+		}
+
+		if !containsString(DriftResourceTypes, resourceId.ResourceType) || principalId.ResourceType != userResourceType.Id {
+			continue
+		}
+
+		key := driftKey{
+			resourceType:  resourceId.ResourceType,
+			resourceId:    resourceId.Resource,
+			principalType: principalId.ResourceType,
+			principalId:   principalId.Resource,
+		}
+
+		prefix := fmt.Sprintf("%s:%s:", resourceId.ResourceType, resourceId.Resource)
+		entitlement := strings.TrimPrefix(g.Entitlement.Id, prefix)
+		if !containsString(rv[key], entitlement) {
+			rv[key] = append(rv[key], entitlement)
+		}
+	}
+
+	for key := range rv {
+		sort.Strings(rv[key])
+	}
+
+	return rv
+}
+
+// DiffGrants compares the grants of a snapshot with the live ones. A user that has other entitlements on a
+// resource than before, e.g. another permission on a service, is reported as changed.
+func DiffGrants(snapshot, live []*v2.Grant) *DriftReport {
+	before := groupDriftGrants(snapshot)
+	after := groupDriftGrants(live)
+
+	keys := make([]driftKey, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.resourceType != b.resourceType {
+			return a.resourceType < b.resourceType
+		}
+		if a.resourceId != b.resourceId {
+			return a.resourceId < b.resourceId
+		}
+
+		return a.principalId < b.principalId
+	})
+
+	report := &DriftReport{Drift: []GrantDrift{}}
+	for _, key := range keys {
+		was, is := before[key], after[key]
+
+		var change string
+		switch {
+		case len(was) == 0:
+			change = driftAdded
+			report.Added++
+		case len(is) == 0:
+			change = driftRemoved
+			report.Removed++
+		case strings.Join(was, ",") != strings.Join(is, ","):
+			change = driftChanged
+			report.Changed++
+		default:
+			continue
+		}
+
+		report.Drift = append(report.Drift, GrantDrift{
+			Change:        change,
+			ResourceType:  key.resourceType,
+			ResourceID:    key.resourceId,
+			PrincipalType: key.principalType,
+			PrincipalID:   key.principalId,
+			Before:        nonNilStrings(was),
+			After:         nonNilStrings(is),
+		})
+	}
+
+	return report
+}
+
+// nonNilStrings returns an empty slice for nil, so that it is encoded as an empty JSON array.
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
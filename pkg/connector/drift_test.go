@@ -0,0 +1,103 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+)
+
+func TestDiffGrants(t *testing.T) {
+	service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc"}}
+	engineer := &v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: engineerRole}}
+	superuser := &v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: superUserRole}}
+	acl := &v2.Resource{Id: &v2.ResourceId{ResourceType: aclResourceType.Id, Resource: "acl"}}
+	user := func(id string) *v2.ResourceId {
+		return &v2.ResourceId{ResourceType: userResourceType.Id, Resource: id}
+	}
+
+	tests := []struct {
+		name     string
+		snapshot []*v2.Grant
+		live     []*v2.Grant
+		want     []GrantDrift
+	}{
+		{
+			name:     "no drift",
+			snapshot: []*v2.Grant{grant.NewGrant(engineer, assignedEntitlement, user("u1"))},
+			live:     []*v2.Grant{grant.NewGrant(engineer, assignedEntitlement, user("u1"))},
+			want:     []GrantDrift{},
+		},
+		{
+			name:     "role added and removed",
+			snapshot: []*v2.Grant{grant.NewGrant(engineer, assignedEntitlement, user("u1"))},
+			live:     []*v2.Grant{grant.NewGrant(superuser, assignedEntitlement, user("u1"))},
+			want: []GrantDrift{
+				{Change: driftRemoved, ResourceType: roleResourceType.Id, ResourceID: engineerRole, PrincipalType: userResourceType.Id, PrincipalID: "u1", Before: []string{assignedEntitlement}, After: []string{}},
+				{Change: driftAdded, ResourceType: roleResourceType.Id, ResourceID: superUserRole, PrincipalType: userResourceType.Id, PrincipalID: "u1", Before: []string{}, After: []string{assignedEntitlement}},
+			},
+		},
+		{
+			name: "service permission changed",
+			snapshot: []*v2.Grant{
+				grant.NewGrant(service, readStatsAndConfigurationEntitlement, user("u1")),
+			},
+			live: []*v2.Grant{
+				grant.NewGrant(service, readStatsAndConfigurationEntitlement, user("u1")),
+				grant.NewGrant(service, readStatsAndConfigurationEntitlement, user("u1")),
+				grant.NewGrant(service, purgeAllEntitlement, user("u1")),
+			},
+			want: []GrantDrift{
+				{
+					Change:        driftChanged,
+					ResourceType:  serviceResourceType.Id,
+					ResourceID:    "svc",
+					PrincipalType: userResourceType.Id,
+					PrincipalID:   "u1",
+					Before:        []string{readStatsAndConfigurationEntitlement},
+					After:         []string{purgeAllEntitlement, readStatsAndConfigurationEntitlement},
+				},
+			},
+		},
+		{
+			name: "grants to other principals and resource types are ignored",
+			live: []*v2.Grant{
+				grant.NewGrant(service, accessEntitlement, superuser.Id),
+				grant.NewGrant(acl, manageEntriesEntitlement, user("u1")),
+			},
+			want: []GrantDrift{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			report := DiffGrants(tt.snapshot, tt.live)
+
+			if !reflect.DeepEqual(report.Drift, tt.want) {
+				t.Errorf("drift = %+v, want %+v", report.Drift, tt.want)
+			}
+
+			var added, removed, changed int
+			for _, drift := range tt.want {
+				switch drift.Change {
+				case driftAdded:
+					added++
+				case driftRemoved:
+					removed++
+				case driftChanged:
+					changed++
+				}
+			}
+
+			if report.Added != added || report.Removed != removed || report.Changed != changed {
+				t.Errorf("counts = %d/%d/%d, want %d/%d/%d", report.Added, report.Removed, report.Changed, added, removed, changed)
+			}
+
+			if report.HasDrift() != (len(tt.want) > 0) {
+				t.Errorf("HasDrift() = %v, want %v", report.HasDrift(), len(tt.want) > 0)
+			}
+		})
+	}
+}
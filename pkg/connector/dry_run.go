@@ -0,0 +1,204 @@
+package connector
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// plannedCall is a Fastly API call a dry run would have made.
+type plannedCall struct {
+	method      string
+	path        string
+	description string
+	params      map[string]interface{}
+}
+
+// provisioningPlan is what a Grant or Revoke would have done, computed in dry-run mode from the current
+// state in Fastly without changing anything.
+type provisioningPlan struct {
+	action      string
+	calls       []plannedCall
+	sideEffects []string
+}
+
+func newProvisioningPlan(action string) *provisioningPlan {
+	return &provisioningPlan{action: action}
+}
+
+func (p *provisioningPlan) call(method, path, description string, params map[string]interface{}) {
+	p.calls = append(p.calls, plannedCall{method: method, path: path, description: description, params: params})
+}
+
+func (p *provisioningPlan) sideEffect(format string, args ...interface{}) {
+	p.sideEffects = append(p.sideEffects, fmt.Sprintf(format, args...))
+}
+
+// log logs every planned call and side effect.
+func (p *provisioningPlan) log(l *zap.Logger) {
+	if len(p.calls) == 0 {
+		l.Info("baton-fastly: dry run: nothing to change", zap.String("action", p.action))
+	}
+
+	for _, call := range p.calls {
+		l.Info(
+			"baton-fastly: dry run: would call the Fastly API",
+			zap.String("action", p.action),
+			zap.String("method", call.method),
+			zap.String("path", call.path),
+			zap.String("description", call.description),
+			zap.Any("params", call.params),
+		)
+	}
+
+	for _, sideEffect := range p.sideEffects {
+		l.Info(
+			"baton-fastly: dry run: side effect",
+			zap.String("action", p.action),
+			zap.String("side_effect", sideEffect),
+		)
+	}
+}
+
+// annotations returns the plan as an annotation of the Grant or Revoke response.
+func (p *provisioningPlan) annotations() (annotations.Annotations, error) {
+	calls := make([]interface{}, 0, len(p.calls))
+	for _, call := range p.calls {
+		entry := map[string]interface{}{
+			"method":      call.method,
+			"path":        call.path,
+			"description": call.description,
+		}
+
+		if len(call.params) > 0 {
+			entry["params"] = call.params
+		}
+
+		calls = append(calls, entry)
+	}
+
+	sideEffects := make([]interface{}, 0, len(p.sideEffects))
+	for _, sideEffect := range p.sideEffects {
+		sideEffects = append(sideEffects, sideEffect)
+	}
+
+	plan, err := structpb.NewStruct(map[string]interface{}{
+		"dry_run":      true,
+		"action":       p.action,
+		"calls":        calls,
+		"side_effects": sideEffects,
+	})
+	if err != nil {
+		return nil, wrapError(err, "failed to create dry run plan")
+	}
+
+	var annos annotations.Annotations
+	annos.Append(plan)
+
+	return annos, nil
+}
+
+// result logs the plan and returns it as annotations.
+func (p *provisioningPlan) result(l *zap.Logger) (annotations.Annotations, error) {
+	p.log(l)
+
+	return p.annotations()
+}
+
+// planRoleChange plans changing the role of the user, which replaces the role the user has now.
+func planRoleChange(client *fastly.Client, action, userId, role string) (*provisioningPlan, error) {
+	plan := newProvisioningPlan(action)
+
+	user, err := client.GetUser(&fastly.GetUserInput{ID: userId})
+	if err != nil {
+		return nil, wrapError(err, "failed to get user")
+	}
+
+	if user.Role == role {
+		return plan, nil
+	}
+
+	plan.call(http.MethodPut, fmt.Sprintf("/user/%s", userId), "UpdateUser", map[string]interface{}{"role": role})
+	plan.sideEffect("user %s loses the %s role, a user has exactly one role", user.Login, user.Role)
+
+	return plan, nil
+}
+
+// planRoleAssignment plans assigning an IAM role to the user, or removing it, which leaves the other
+// roles of the user alone.
+func planRoleAssignment(action, userId, roleId string, assigned, assign bool) *provisioningPlan {
+	plan := newProvisioningPlan(action)
+
+	if assigned == assign {
+		return plan
+	}
+
+	method, description := http.MethodPost, "AddUserRole"
+	if !assign {
+		method, description = http.MethodDelete, "RemoveUserRole"
+	}
+
+	plan.call(method, fmt.Sprintf("/users/%s/roles", userId), description, map[string]interface{}{"role_id": roleId})
+
+	return plan
+}
+
+// planServiceAuthorization plans setting the permission of the user on the service, creating the
+// service authorization or updating the existing one. An empty permission removes the service authorization.
+func planServiceAuthorization(action string, current *fastly.ServiceAuthorization, serviceId, userId, permission string) *provisioningPlan {
+	plan := newProvisioningPlan(action)
+
+	if permission == "" {
+		if current != nil {
+			plan.call(http.MethodDelete, fmt.Sprintf("/service-authorizations/%s", current.ID), "DeleteServiceAuthorization", nil)
+			plan.sideEffect("user %s loses all access to service %s", userId, serviceId)
+		}
+
+		return plan
+	}
+
+	if current == nil {
+		plan.call(http.MethodPost, "/service-authorizations", "CreateServiceAuthorization", map[string]interface{}{
+			"service_id": serviceId,
+			"user_id":    userId,
+			"permission": permission,
+		})
+
+		return plan
+	}
+
+	if current.Permission == permission {
+		return plan
+	}
+
+	plan.call(http.MethodPatch, fmt.Sprintf("/service-authorizations/%s", current.ID), "UpdateServiceAuthorization", map[string]interface{}{
+		"permission": permission,
+	})
+
+	kept := permissionEntitlementMap[permission]
+	for _, entitlement := range permissionEntitlementMap[current.Permission] {
+		if !containsString(kept, entitlement) {
+			plan.sideEffect("user %s loses the %s entitlement of service %s", userId, entitlement, serviceId)
+		}
+	}
+
+	return plan
+}
+
+// planProductEnablement plans enabling or disabling the product on the service.
+func planProductEnablement(action string, product fastly.Product, serviceId string, enabled bool) *provisioningPlan {
+	plan := newProvisioningPlan(action)
+	path := fmt.Sprintf("/enabled-products/%s/services/%s", product, serviceId)
+
+	if enabled {
+		plan.call(http.MethodPut, path, "EnableProduct", nil)
+	} else {
+		plan.call(http.MethodDelete, path, "DisableProduct", nil)
+	}
+
+	return plan
+}
@@ -0,0 +1,218 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// plannedCalls returns the planned calls as "<method> <path> <description>".
+func plannedCalls(plan *provisioningPlan) []string {
+	var rv []string
+	for _, call := range plan.calls {
+		rv = append(rv, call.method+" "+call.path+" "+call.description)
+	}
+
+	return rv
+}
+
+func TestPlanServiceAuthorization(t *testing.T) {
+	tests := []struct {
+		name            string
+		current         *fastly.ServiceAuthorization
+		permission      string
+		wantCalls       []string
+		wantSideEffects []string
+	}{
+		{
+			name:       "create",
+			permission: PurgeAllPermission,
+			wantCalls:  []string{"POST /service-authorizations CreateServiceAuthorization"},
+		},
+		{
+			name:       "unchanged",
+			current:    &fastly.ServiceAuthorization{ID: "sa1", Permission: PurgeAllPermission},
+			permission: PurgeAllPermission,
+		},
+		{
+			name:       "update gaining entitlements",
+			current:    &fastly.ServiceAuthorization{ID: "sa1", Permission: ReadOnlyPermission},
+			permission: FullAccessPermission,
+			wantCalls:  []string{"PATCH /service-authorizations/sa1 UpdateServiceAuthorization"},
+		},
+		{
+			name:       "update losing entitlements",
+			current:    &fastly.ServiceAuthorization{ID: "sa1", Permission: FullAccessPermission},
+			permission: PurgeSelectPermission,
+			wantCalls:  []string{"PATCH /service-authorizations/sa1 UpdateServiceAuthorization"},
+			wantSideEffects: []string{
+				"user u1 loses the purge-all entitlement of service svc",
+				"user u1 loses the full-access entitlement of service svc",
+			},
+		},
+		{
+			name:            "delete",
+			current:         &fastly.ServiceAuthorization{ID: "sa1", Permission: ReadOnlyPermission},
+			wantCalls:       []string{"DELETE /service-authorizations/sa1 DeleteServiceAuthorization"},
+			wantSideEffects: []string{"user u1 loses all access to service svc"},
+		},
+		{
+			name: "delete without a service authorization",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planServiceAuthorization("grant", tt.current, "svc", "u1", tt.permission)
+
+			if got := plannedCalls(plan); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", got, tt.wantCalls)
+			}
+
+			if !reflect.DeepEqual(plan.sideEffects, tt.wantSideEffects) {
+				t.Errorf("side effects = %q, want %q", plan.sideEffects, tt.wantSideEffects)
+			}
+		})
+	}
+}
+
+func TestPlanRoleChange(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.addUser("u-alice", "alice", "engineer")
+	client := f.client()
+
+	plan, err := planRoleChange(client, "grant", "u-alice", "superuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := plannedCalls(plan), []string{"PUT /user/u-alice UpdateUser"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+
+	if want := []string{"user alice loses the engineer role, a user has exactly one role"}; !reflect.DeepEqual(plan.sideEffects, want) {
+		t.Errorf("side effects = %q, want %q", plan.sideEffects, want)
+	}
+
+	plan, err = planRoleChange(client, "grant", "u-alice", "engineer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.calls) != 0 || len(plan.sideEffects) != 0 {
+		t.Errorf("plan of the role the user has = %q, %q, want nothing", plannedCalls(plan), plan.sideEffects)
+	}
+}
+
+// planAnnotation returns the dry-run plan annotated on a Grant or Revoke response.
+func planAnnotation(t *testing.T, annos annotations.Annotations) map[string]interface{} {
+	plan := &structpb.Struct{}
+	ok, err := annos.Pick(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("no dry run plan annotation")
+	}
+
+	return plan.AsMap()
+}
+
+func TestDryRunGrantAndRevoke(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.addUser("u-alice", "alice", "engineer")
+	f.addAuthorization("svc-a", "u-alice", "purge_all")
+
+	client := f.client()
+	roles := newRoleBuilder(client, "cust", true, nil)
+	services := newServiceBuilder(client, "cust", nil, true, nil, newSyncCache(client, "cust"))
+
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "u-alice"}}
+	superuser := &v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: superUserRole}}
+	service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc-a"}}
+
+	tests := []struct {
+		name      string
+		provision func() (annotations.Annotations, error)
+		action    string
+		wantPath  string
+	}{
+		{
+			name: "role grant",
+			provision: func() (annotations.Annotations, error) {
+				return roles.Grant(context.Background(), user, ent.NewAssignmentEntitlement(superuser, assignedEntitlement))
+			},
+			action:   "grant",
+			wantPath: "/user/u-alice",
+		},
+		{
+			name: "role revoke",
+			provision: func() (annotations.Annotations, error) {
+				return roles.Revoke(context.Background(), newPolicyGrant(&v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: engineerRole}}, assignedEntitlement, user))
+			},
+			action:   "revoke",
+			wantPath: "/user/u-alice",
+		},
+		{
+			name: "service grant",
+			provision: func() (annotations.Annotations, error) {
+				return services.Grant(context.Background(), user, ent.NewAssignmentEntitlement(service, fullAccessEntitlement))
+			},
+			action:   "grant",
+			wantPath: "/service-authorizations/sa1",
+		},
+		{
+			name: "service revoke",
+			provision: func() (annotations.Annotations, error) {
+				return services.Revoke(context.Background(), newPolicyGrant(service, purgeAllEntitlement, user))
+			},
+			action:   "revoke",
+			wantPath: "/service-authorizations/sa1",
+		},
+	}
+
+	for _, tt := range tests {
+		annos, err := tt.provision()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		plan := planAnnotation(t, annos)
+		if plan["dry_run"] != true || plan["action"] != tt.action {
+			t.Errorf("%s: plan = %v, want a dry run %s", tt.name, plan, tt.action)
+		}
+
+		calls, _ := plan["calls"].([]interface{})
+		if len(calls) != 1 {
+			t.Fatalf("%s: planned calls = %v, want one", tt.name, calls)
+		}
+
+		if path := calls[0].(map[string]interface{})["path"]; path != tt.wantPath {
+			t.Errorf("%s: planned path = %v, want %s", tt.name, path, tt.wantPath)
+		}
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if n := f.countRequestsUnder(method, "/"); n != 0 {
+			t.Errorf("the server received %d %s requests, want none", n, method)
+		}
+	}
+
+	if role := f.user("u-alice").role; role != "engineer" {
+		t.Errorf("role = %q, want engineer", role)
+	}
+
+	if permission := f.permission("svc-a", "u-alice"); permission != "purge_all" {
+		t.Errorf("permission = %q, want purge_all", permission)
+	}
+}
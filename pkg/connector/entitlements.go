@@ -10,4 +10,7 @@ const (
 	purgeAllEntitlement                  = "purge-all"
 	fullAccessEntitlement                = "full-access"
 	accessEntitlement                    = "access"
+	manageEntriesEntitlement             = "manage-entries"
+	memberEntitlement                    = "member"
+	pendingEntitlement                   = "pending"
 )
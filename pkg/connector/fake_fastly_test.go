@@ -0,0 +1,510 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+// fakeFastly is an in-memory Fastly API serving the users, services, service authorizations and IAM role
+// assignments of one account. Without IAM roles it looks like an account that has not been migrated to IAM,
+// so the roles endpoint responds with 404.
+type fakeFastly struct {
+	t   *testing.T
+	mtx sync.Mutex
+
+	customerId     string
+	users          map[string]*fakeUser
+	services       map[string]string
+	authorizations map[string]*fakeAuthorization
+	userRoles      map[string][]string
+	// iamRoles are the names of the IAM roles, by role ID.
+	iamRoles map[string]string
+	// serviceGroups are the names of the IAM service groups, by service group ID, and serviceGroupServices
+	// the IDs of their services.
+	serviceGroups        map[string]string
+	serviceGroupServices map[string][]string
+	// userGroups are the names of the IAM user groups, by user group ID, and userGroupRoles and
+	// userGroupServiceGroups the IDs of the roles and service groups assigned to them.
+	userGroups             map[string]string
+	userGroupRoles         map[string][]string
+	userGroupServiceGroups map[string][]string
+	// userServiceGroups are the IDs of the service groups assigned to each user, by user ID.
+	userServiceGroups map[string][]string
+	// activeVersions are the numbers of the active versions of the services, and domains the names of the
+	// domains of those versions, by service ID.
+	activeVersions map[string]int
+	domains        map[string][]string
+	// products are the products enabled on each service, by service ID.
+	products map[string][]string
+	// failures makes requests fail with the status code, by "<method> <path>".
+	failures map[string]int
+	// requests are the requests the API received, as "<method> <path>".
+	requests []string
+	lastId   int
+}
+
+type fakeUser struct {
+	login  string
+	role   string
+	locked bool
+}
+
+type fakeAuthorization struct {
+	serviceId  string
+	userId     string
+	permission string
+}
+
+func newFakeFastly(t *testing.T, customerId string) *fakeFastly {
+	return &fakeFastly{
+		t:              t,
+		customerId:     customerId,
+		users:          make(map[string]*fakeUser),
+		services:       make(map[string]string),
+		authorizations: make(map[string]*fakeAuthorization),
+		userRoles:      make(map[string][]string),
+		iamRoles:       make(map[string]string),
+		activeVersions: make(map[string]int),
+		domains:        make(map[string][]string),
+		products:       make(map[string][]string),
+		failures:       make(map[string]int),
+
+		serviceGroups:          make(map[string]string),
+		serviceGroupServices:   make(map[string][]string),
+		userGroups:             make(map[string]string),
+		userGroupRoles:         make(map[string][]string),
+		userGroupServiceGroups: make(map[string][]string),
+		userServiceGroups:      make(map[string][]string),
+	}
+}
+
+func (f *fakeFastly) addUser(id, login, role string) {
+	f.users[id] = &fakeUser{login: login, role: role}
+}
+
+func (f *fakeFastly) addAuthorization(serviceId, userId, permission string) string {
+	f.lastId++
+	id := fmt.Sprintf("sa%d", f.lastId)
+	f.authorizations[id] = &fakeAuthorization{serviceId: serviceId, userId: userId, permission: permission}
+
+	return id
+}
+
+// permission returns the permission of the user on the service, which is empty without a service authorization.
+func (f *fakeFastly) permission(serviceId, userId string) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for _, authorization := range f.authorizations {
+		if authorization.serviceId == serviceId && authorization.userId == userId {
+			return authorization.permission
+		}
+	}
+
+	return ""
+}
+
+func (f *fakeFastly) user(id string) fakeUser {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return *f.users[id]
+}
+
+func (f *fakeFastly) roles(userId string) []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return append([]string(nil), f.userRoles[userId]...)
+}
+
+// countRequests returns how many requests the API received with the method and path.
+func (f *fakeFastly) countRequests(method, path string) int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	count := 0
+	for _, request := range f.requests {
+		if request == method+" "+path {
+			count++
+		}
+	}
+
+	return count
+}
+
+// countRequestsUnder returns how many requests the API received with the method and a path starting with prefix.
+func (f *fakeFastly) countRequestsUnder(method, prefix string) int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	count := 0
+	for _, request := range f.requests {
+		if strings.HasPrefix(request, method+" "+prefix) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// url starts serving the API and returns its URL. The server is closed when the test ends.
+func (f *fakeFastly) url() string {
+	server := httptest.NewServer(f)
+	f.t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+// client starts serving the API and returns a client for it.
+func (f *fakeFastly) client() *fastly.Client {
+	client, err := fastly.NewClientForEndpoint("token", f.url())
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return client
+}
+
+func (f *fakeFastly) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if status, ok := f.failures[r.Method+" "+r.URL.Path]; ok {
+		f.writeError(w, status)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/current_user":
+		f.writeJSON(w, map[string]interface{}{"id": "u-token", "login": "token", "role": "superuser", "customer_id": f.customerId})
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "customer" && parts[2] == "users":
+		ids := make([]string, 0, len(f.users))
+		for id := range f.users {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		rv := make([]map[string]interface{}, 0, len(ids))
+		for _, id := range ids {
+			rv = append(rv, f.userJSON(id))
+		}
+
+		f.writeJSON(w, rv)
+	case len(parts) == 2 && parts[0] == "user":
+		if _, ok := f.users[parts[1]]; !ok {
+			f.writeError(w, http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			if err := r.ParseForm(); err != nil {
+				f.t.Errorf("failed to parse user update: %v", err)
+			}
+
+			if role := r.PostForm.Get("role"); role != "" {
+				f.users[parts[1]].role = role
+			}
+
+			if locked := r.PostForm.Get("locked"); locked != "" {
+				f.users[parts[1]].locked = locked == "1"
+			}
+		}
+
+		f.writeJSON(w, f.userJSON(parts[1]))
+	case r.Method == http.MethodGet && r.URL.Path == "/service":
+		rv := []map[string]interface{}{}
+		if page := r.URL.Query().Get("page"); page == "" || page == "1" {
+			for id, name := range f.services {
+				rv = append(rv, map[string]interface{}{
+					"id":          id,
+					"name":        name,
+					"type":        "vcl",
+					"version":     f.activeVersions[id],
+					"customer_id": f.customerId,
+				})
+			}
+		}
+
+		f.writeJSON(w, rv)
+	case r.Method == http.MethodGet && len(parts) == 5 && parts[0] == "service" && parts[2] == "version" && parts[4] == "domain":
+		if version := fmt.Sprint(f.activeVersions[parts[1]]); parts[3] != version {
+			f.t.Errorf("domains of version %s of %s listed, want the active version %s", parts[3], parts[1], version)
+		}
+
+		rv := []map[string]interface{}{}
+		for _, name := range f.domains[parts[1]] {
+			rv = append(rv, map[string]interface{}{"name": name, "service_id": parts[1], "version": f.activeVersions[parts[1]]})
+		}
+
+		f.writeJSON(w, rv)
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[0] == "enabled-products":
+		if !containsString(f.products[parts[3]], parts[1]) {
+			f.writeError(w, http.StatusNotFound)
+			return
+		}
+
+		f.writeJSON(w, map[string]interface{}{
+			"product": map[string]interface{}{"id": parts[1]},
+			"service": map[string]interface{}{"id": parts[3]},
+		})
+	case r.Method == http.MethodGet && r.URL.Path == "/roles":
+		if len(f.iamRoles) == 0 {
+			f.writeError(w, http.StatusNotFound)
+			return
+		}
+
+		f.writeIAMList(w, namedJSON(f.iamRoles))
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "roles" && parts[2] == "permissions":
+		f.writeIAMList(w, []map[string]interface{}{})
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "roles":
+		f.serveUserRoles(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "service-groups":
+		f.serveServiceGroupAssignments(w, r, f.userServiceGroups, parts[1])
+	case r.Method == http.MethodGet && r.URL.Path == "/service-groups":
+		f.writeIAMList(w, namedJSON(f.serviceGroups))
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "service-groups" && parts[2] == "services":
+		data := []map[string]interface{}{}
+		for _, serviceId := range f.serviceGroupServices[parts[1]] {
+			data = append(data, map[string]interface{}{"id": serviceId, "name": f.services[serviceId], "type": "vcl"})
+		}
+
+		f.writeIAMList(w, data)
+	case r.Method == http.MethodGet && r.URL.Path == "/user-groups":
+		f.writeIAMList(w, namedJSON(f.userGroups))
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "user-groups" && parts[2] == "roles":
+		data := []map[string]interface{}{}
+		for _, roleId := range f.userGroupRoles[parts[1]] {
+			data = append(data, map[string]interface{}{"id": roleId, "name": f.iamRoles[roleId]})
+		}
+
+		f.writeIAMList(w, data)
+	case len(parts) == 3 && parts[0] == "user-groups" && parts[2] == "service-groups":
+		f.serveServiceGroupAssignments(w, r, f.userGroupServiceGroups, parts[1])
+	case parts[0] == "service-authorizations":
+		f.serveAuthorizations(w, r, parts)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		f.writeError(w, http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeFastly) serveUserRoles(w http.ResponseWriter, r *http.Request, userId string) {
+	if r.Method == http.MethodGet {
+		data := []map[string]interface{}{}
+		for _, roleId := range f.userRoles[userId] {
+			data = append(data, map[string]interface{}{"id": roleId, "name": roleId})
+		}
+
+		f.writeIAMList(w, data)
+		return
+	}
+
+	var body iamRolesRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		f.t.Errorf("failed to decode role assignment: %v", err)
+	}
+
+	for _, role := range body.Roles {
+		var rv []string
+		for _, roleId := range f.userRoles[userId] {
+			if roleId != role.ID {
+				rv = append(rv, roleId)
+			}
+		}
+
+		if r.Method == http.MethodPost {
+			rv = append(rv, role.ID)
+		}
+
+		f.userRoles[userId] = rv
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveServiceGroupAssignments lists, adds and removes the service groups assigned to the user group or
+// user with the ID.
+func (f *fakeFastly) serveServiceGroupAssignments(w http.ResponseWriter, r *http.Request, assignments map[string][]string, id string) {
+	if r.Method == http.MethodGet {
+		data := []map[string]interface{}{}
+		for _, serviceGroupId := range assignments[id] {
+			data = append(data, map[string]interface{}{"id": serviceGroupId, "name": f.serviceGroups[serviceGroupId]})
+		}
+
+		f.writeIAMList(w, data)
+		return
+	}
+
+	var body iamServiceGroupsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		f.t.Errorf("failed to decode service group assignment: %v", err)
+	}
+
+	for _, serviceGroup := range body.ServiceGroups {
+		var rv []string
+		for _, serviceGroupId := range assignments[id] {
+			if serviceGroupId != serviceGroup.ID {
+				rv = append(rv, serviceGroupId)
+			}
+		}
+
+		if r.Method == http.MethodPost {
+			rv = append(rv, serviceGroup.ID)
+		}
+
+		assignments[id] = rv
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeFastly) serveAuthorizations(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1:
+		ids := make([]string, 0, len(f.authorizations))
+		if page := r.URL.Query().Get("page[number]"); page == "" || page == "1" {
+			for id := range f.authorizations {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+
+		data := make([]map[string]interface{}, 0, len(ids))
+		for _, id := range ids {
+			data = append(data, f.authorizationJSON(id))
+		}
+
+		f.writeIAMList(w, data)
+	case r.Method == http.MethodPost && len(parts) == 1:
+		var body struct {
+			Data struct {
+				Attributes struct {
+					Permission string `json:"permission"`
+				} `json:"attributes"`
+				Relationships map[string]struct {
+					Data struct {
+						ID string `json:"id"`
+					} `json:"data"`
+				} `json:"relationships"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			f.t.Errorf("failed to decode service authorization: %v", err)
+		}
+
+		f.lastId++
+		id := fmt.Sprintf("sa%d", f.lastId)
+		f.authorizations[id] = &fakeAuthorization{
+			serviceId:  body.Data.Relationships["service"].Data.ID,
+			userId:     body.Data.Relationships["user"].Data.ID,
+			permission: body.Data.Attributes.Permission,
+		}
+
+		f.writeJSON(w, map[string]interface{}{"data": f.authorizationJSON(id)})
+	case len(parts) == 2:
+		authorization, ok := f.authorizations[parts[1]]
+		if !ok {
+			f.writeError(w, http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPatch:
+			var body struct {
+				Data struct {
+					Attributes struct {
+						Permission string `json:"permission"`
+					} `json:"attributes"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				f.t.Errorf("failed to decode service authorization: %v", err)
+			}
+
+			authorization.permission = body.Data.Attributes.Permission
+			f.writeJSON(w, map[string]interface{}{"data": f.authorizationJSON(parts[1])})
+		case http.MethodDelete:
+			delete(f.authorizations, parts[1])
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			f.writeJSON(w, map[string]interface{}{"data": f.authorizationJSON(parts[1])})
+		}
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		f.writeError(w, http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeFastly) userJSON(id string) map[string]interface{} {
+	user := f.users[id]
+
+	return map[string]interface{}{
+		"id":          id,
+		"login":       user.login,
+		"role":        user.role,
+		"locked":      user.locked,
+		"customer_id": f.customerId,
+	}
+}
+
+func (f *fakeFastly) authorizationJSON(id string) map[string]interface{} {
+	authorization := f.authorizations[id]
+
+	return map[string]interface{}{
+		"type": "service_authorization",
+		"id":   id,
+		"attributes": map[string]interface{}{
+			"permission": authorization.permission,
+		},
+		"relationships": map[string]interface{}{
+			"service": map[string]interface{}{"data": map[string]interface{}{"type": "service", "id": authorization.serviceId}},
+			"user":    map[string]interface{}{"data": map[string]interface{}{"type": "user", "id": authorization.userId}},
+		},
+	}
+}
+
+func (f *fakeFastly) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		f.t.Errorf("failed to encode response: %v", err)
+	}
+}
+
+func (f *fakeFastly) writeIAMList(w http.ResponseWriter, data []map[string]interface{}) {
+	f.writeJSON(w, map[string]interface{}{"data": data, "meta": map[string]interface{}{"total_pages": 1}})
+}
+
+func (f *fakeFastly) writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"msg":%q}`, http.StatusText(status))
+}
+
+// namedJSON returns the IDs and names of the IAM objects, sorted by ID.
+func namedJSON(names map[string]string) []map[string]interface{} {
+	ids := make([]string, 0, len(names))
+	for id := range names {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rv := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		rv = append(rv, map[string]interface{}{"id": id, "name": names[id]})
+	}
+
+	return rv
+}
@@ -0,0 +1,548 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	elevationKindRole    = "role"
+	elevationKindIAMRole = "iam_role"
+	elevationKindService = "service"
+
+	// AnyEntitlement is the grant duration key that applies to every role and service permission.
+	AnyEntitlement = "*"
+	// roleDurationPrefix prefixes role IDs in grant duration keys, e.g. "role:Superuser".
+	roleDurationPrefix = "role:"
+)
+
+// elevation is a time-bound grant, together with the state before it, so that it can be reverted exactly
+// once it expires. Previous is the role the user had, or the permission the user had on the service, which
+// is empty when the user had no service authorization at all. IAM roles are assigned next to the other roles
+// of the user, so for them Previous is the role itself when the user already had it and empty otherwise.
+type elevation struct {
+	CustomerID  string    `json:"customer_id"`
+	Kind        string    `json:"kind"`
+	UserID      string    `json:"user_id"`
+	ServiceID   string    `json:"service_id,omitempty"`
+	Entitlement string    `json:"entitlement"`
+	Previous    string    `json:"previous"`
+	Elevated    string    `json:"elevated"`
+	GrantedAt   time.Time `json:"granted_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (e *elevation) key() string {
+	if e.Kind == elevationKindIAMRole {
+		return elevationKey(e.CustomerID, e.Kind, e.UserID, e.Entitlement)
+	}
+
+	return elevationKey(e.CustomerID, e.Kind, e.UserID, e.ServiceID)
+}
+
+// elevationKey identifies the elevation of a user. The resource ID is the service of a service elevation,
+// the role of an IAM role elevation, and empty for the hard-coded roles, of which a user has exactly one.
+func elevationKey(customerId, kind, userId, resourceId string) string {
+	return strings.Join([]string{customerId, kind, userId, resourceId}, "|")
+}
+
+// metadata is the grant metadata of the elevation.
+func (e *elevation) metadata() map[string]interface{} {
+	previousKey := "previous_permission"
+	if e.Kind != elevationKindService {
+		previousKey = "previous_role"
+	}
+
+	return map[string]interface{}{
+		"granted_at": e.GrantedAt.UTC().Format(time.RFC3339),
+		"expires_at": e.ExpiresAt.UTC().Format(time.RFC3339),
+		previousKey:  e.Previous,
+	}
+}
+
+// annotations returns the grant metadata of the elevation as an annotation of the Grant response.
+func (e *elevation) annotations() (annotations.Annotations, error) {
+	metadata, err := structpb.NewStruct(e.metadata())
+	if err != nil {
+		return nil, wrapError(err, "failed to create grant metadata")
+	}
+
+	var annos annotations.Annotations
+	annos.Append(metadata)
+
+	return annos, nil
+}
+
+// timeBoundGrants makes grants of roles and service permissions expire, and keeps the state before
+// each of them in a JSON file, so that the file is shared by the connector and the expire-grants command.
+// Every change of the file holds a lock on the lock file next to it, so that processes sharing the file
+// never overwrite each other's changes.
+type timeBoundGrants struct {
+	durations map[string]time.Duration
+	path      string
+	audit     *auditLog
+	mtx       *sync.Mutex
+}
+
+func newTimeBoundGrants(durations map[string]time.Duration, path string) (*timeBoundGrants, error) {
+	for key, duration := range durations {
+		if duration <= 0 {
+			return nil, fmt.Errorf("baton-fastly: grant duration of %q must be positive", key)
+		}
+	}
+
+	if path == "" {
+		if len(durations) > 0 {
+			return nil, fmt.Errorf("baton-fastly: a grant state file is required for grant durations")
+		}
+
+		return nil, nil
+	}
+
+	return &timeBoundGrants{durations: durations, path: path, mtx: &sync.Mutex{}}, nil
+}
+
+// withDuration returns time-bound grants sharing the state file, in which every grant lasts the duration.
+func (t *timeBoundGrants) withDuration(duration time.Duration) *timeBoundGrants {
+	return &timeBoundGrants{
+		durations: map[string]time.Duration{AnyEntitlement: duration},
+		path:      t.path,
+		audit:     t.audit,
+		mtx:       t.mtx,
+	}
+}
+
+// roleDuration returns how long grants of the role last, if they are time-bound.
+func (t *timeBoundGrants) roleDuration(roleId string) (time.Duration, bool) {
+	return t.duration(roleDurationPrefix + roleId)
+}
+
+// serviceDuration returns how long grants of the service entitlement last, if they are time-bound.
+func (t *timeBoundGrants) serviceDuration(entitlement string) (time.Duration, bool) {
+	return t.duration(entitlement)
+}
+
+func (t *timeBoundGrants) duration(key string) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	if duration, ok := t.durations[key]; ok {
+		return duration, true
+	}
+
+	duration, ok := t.durations[AnyEntitlement]
+
+	return duration, ok
+}
+
+// lock takes the lock of the state file, serializing both the goroutines of this process and other
+// processes. The returned function releases it.
+func (t *timeBoundGrants) lock() (func(), error) {
+	t.mtx.Lock()
+
+	f, err := os.OpenFile(t.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		t.mtx.Unlock()
+		return nil, fmt.Errorf("baton-fastly: failed to open grant state lock file: %w", err)
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		t.mtx.Unlock()
+		return nil, fmt.Errorf("baton-fastly: failed to lock grant state file: %w", err)
+	}
+
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+		t.mtx.Unlock()
+	}, nil
+}
+
+func (t *timeBoundGrants) load() (map[string]*elevation, error) {
+	rv := make(map[string]*elevation)
+
+	data, err := os.ReadFile(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("baton-fastly: failed to read grant state file: %w", err)
+	}
+
+	var elevations []*elevation
+	if err := json.Unmarshal(data, &elevations); err != nil {
+		return nil, fmt.Errorf("baton-fastly: failed to parse grant state file: %w", err)
+	}
+
+	for _, e := range elevations {
+		rv[e.key()] = e
+	}
+
+	return rv, nil
+}
+
+// save replaces the state file atomically, so that a crash never leaves a partial file behind.
+func (t *timeBoundGrants) save(elevations map[string]*elevation) error {
+	rv := make([]*elevation, 0, len(elevations))
+	for _, e := range elevations {
+		rv = append(rv, e)
+	}
+
+	sort.Slice(rv, func(i, j int) bool { return rv[i].ExpiresAt.Before(rv[j].ExpiresAt) })
+
+	data, err := json.MarshalIndent(rv, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".*")
+	if err != nil {
+		return fmt.Errorf("baton-fastly: failed to write grant state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("baton-fastly: failed to write grant state file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("baton-fastly: failed to write grant state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		return fmt.Errorf("baton-fastly: failed to write grant state file: %w", err)
+	}
+
+	return nil
+}
+
+// record stores the elevation. A user that is elevated again before the elevation expires keeps the
+// state before the first one, and granting what the user already has permanently is no elevation.
+func (t *timeBoundGrants) record(e *elevation) (*elevation, error) {
+	unlock, err := t.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	elevations, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, ok := elevations[e.key()]; ok {
+		e.Previous = existing.Previous
+		e.GrantedAt = existing.GrantedAt
+		if existing.ExpiresAt.After(e.ExpiresAt) {
+			e.ExpiresAt = existing.ExpiresAt
+		}
+	} else if e.Previous == e.Elevated {
+		return nil, nil
+	}
+
+	elevations[e.key()] = e
+
+	return e, t.save(elevations)
+}
+
+// elevate records the grant as expiring after the duration, and returns its grant metadata as annotations.
+// It is called before the grant is made in Fastly, so that no access is elevated without a record of how to
+// revert it. If the grant then fails, the user does not hold what the elevation granted, so it expires without
+// touching the user.
+func (t *timeBoundGrants) elevate(e *elevation, duration time.Duration) (annotations.Annotations, error) {
+	e.GrantedAt = time.Now().UTC()
+	e.ExpiresAt = e.GrantedAt.Add(duration)
+
+	e, err := t.record(e)
+	if err != nil || e == nil {
+		return nil, err
+	}
+
+	return e.annotations()
+}
+
+// forget drops the elevation of the user, e.g. when the grant is revoked before it expires.
+func (t *timeBoundGrants) forget(customerId, kind, userId, resourceId string) error {
+	if t == nil {
+		return nil
+	}
+
+	unlock, err := t.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	elevations, err := t.load()
+	if err != nil {
+		return err
+	}
+
+	key := elevationKey(customerId, kind, userId, resourceId)
+	if _, ok := elevations[key]; !ok {
+		return nil
+	}
+
+	delete(elevations, key)
+
+	return t.save(elevations)
+}
+
+// expiresAt returns when the elevation with the key expires, as recorded in the state file. It returns
+// fallback when nothing was recorded, e.g. in dry-run mode or when the user already had the grant.
+func (t *timeBoundGrants) expiresAt(key string, fallback time.Time) (*time.Time, error) {
+	elevations, err := t.active()
+	if err != nil {
+		return nil, err
+	}
+
+	if e, ok := elevations[key]; ok {
+		return &e.ExpiresAt, nil
+	}
+
+	return &fallback, nil
+}
+
+// active returns the elevations that have not been reverted yet, by key. The state file is replaced
+// atomically, so reading it needs no lock.
+func (t *timeBoundGrants) active() (map[string]*elevation, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	return t.load()
+}
+
+// expire reverts every elevation that has expired to the state before it. Elevations whose grant has
+// been changed since, e.g. by another role assignment, are dropped without touching the user.
+func (t *timeBoundGrants) expire(ctx context.Context, accounts []*account, now time.Time) ([]*elevation, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	l := ctxzap.Extract(ctx)
+
+	unlock, err := t.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	elevations, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make(map[string]*fastly.Client, len(accounts))
+	for _, account := range accounts {
+		clients[account.customerId] = account.client
+	}
+
+	var reverted []*elevation
+	var errs []error
+	for key, e := range elevations {
+		if now.Before(e.ExpiresAt) {
+			continue
+		}
+
+		client, ok := clients[e.CustomerID]
+		if !ok {
+			l.Warn(
+				"baton-fastly: grant expired in an account that is not synced, keeping it",
+				zap.String("customer_id", e.CustomerID),
+				zap.String("user_id", e.UserID),
+			)
+
+			continue
+		}
+
+		changed, err := revertElevation(client, e)
+		if err != nil {
+			errs = append(errs, err)
+
+			l.Error(
+				"baton-fastly: failed to revert expired grant",
+				zap.Error(err),
+				zap.String("kind", e.Kind),
+				zap.String("user_id", e.UserID),
+				zap.String("service_id", e.ServiceID),
+			)
+
+			continue
+		}
+
+		if changed {
+			reverted = append(reverted, e)
+
+			entry := &auditEntry{
+				Event:      auditEventRollback,
+				CustomerID: e.CustomerID,
+				UserID:     e.UserID,
+				ServiceID:  e.ServiceID,
+				Previous:   e.Previous,
+				ExpiresAt:  &e.ExpiresAt,
+			}
+			if e.Kind != elevationKindService {
+				entry.Role = e.Entitlement
+			} else {
+				entry.Permission = e.Elevated
+			}
+
+			err := t.audit.append(entry)
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			l.Info(
+				"baton-fastly: reverted expired grant",
+				zap.String("kind", e.Kind),
+				zap.String("user_id", e.UserID),
+				zap.String("service_id", e.ServiceID),
+				zap.String("entitlement", e.Entitlement),
+				zap.String("previous", e.Previous),
+				zap.Time("expires_at", e.ExpiresAt),
+			)
+		} else {
+			l.Warn(
+				"baton-fastly: expired grant was changed since it was granted, leaving it as it is",
+				zap.String("kind", e.Kind),
+				zap.String("user_id", e.UserID),
+				zap.String("service_id", e.ServiceID),
+				zap.String("entitlement", e.Entitlement),
+			)
+		}
+
+		delete(elevations, key)
+	}
+
+	if err := t.save(elevations); err != nil {
+		return reverted, err
+	}
+
+	return reverted, errors.Join(errs...)
+}
+
+// revertElevation restores the role or service permission the user had before the elevation, as long as
+// the user still has what was granted. It returns false when the grant has been changed since.
+func revertElevation(client *fastly.Client, e *elevation) (bool, error) {
+	switch e.Kind {
+	case elevationKindRole:
+		user, err := client.GetUser(&fastly.GetUserInput{ID: e.UserID})
+		if err != nil {
+			if isNotFoundError(err) {
+				return false, nil
+			}
+
+			return false, wrapError(err, "failed to get user")
+		}
+
+		if user.Role != e.Elevated {
+			return false, nil
+		}
+
+		_, err = client.UpdateUser(&fastly.UpdateUserInput{ID: e.UserID, Role: &e.Previous})
+		if err != nil {
+			return false, wrapError(err, "failed to restore role of user")
+		}
+
+		return true, nil
+	case elevationKindIAMRole:
+		assigned, err := userHasRole(client, e.UserID, e.Elevated)
+		if err != nil {
+			if isNotFoundError(err) {
+				return false, nil
+			}
+
+			return false, wrapError(err, "failed to list roles of user")
+		}
+
+		if !assigned || e.Previous == e.Elevated {
+			return false, nil
+		}
+
+		if err := removeUserRole(client, e.UserID, e.Elevated); err != nil {
+			return false, wrapError(err, "failed to remove role from user")
+		}
+
+		return true, nil
+	case elevationKindService:
+		authorization, err := findServiceAuthorization(client, e.ServiceID, e.UserID)
+		if err != nil {
+			return false, wrapError(err, "failed to get service authorization")
+		}
+
+		if authorization == nil || authorization.Permission != e.Elevated {
+			return false, nil
+		}
+
+		if e.Previous == "" {
+			err = client.DeleteServiceAuthorization(&fastly.DeleteServiceAuthorizationInput{ID: authorization.ID})
+			if err != nil {
+				return false, wrapError(err, "failed to delete service authorization")
+			}
+
+			return true, nil
+		}
+
+		_, err = client.UpdateServiceAuthorization(&fastly.UpdateServiceAuthorizationInput{
+			ID:         authorization.ID,
+			Permission: e.Previous,
+		})
+		if err != nil {
+			return false, wrapError(err, "failed to restore service permission of user")
+		}
+
+		return true, nil
+	default:
+		return false, fmt.Errorf("baton-fastly: unknown kind of grant %q", e.Kind)
+	}
+}
+
+// ExpireGrantsEvery reverts the time-bound grants that have expired every interval, until the context is
+// done. Failures are logged and retried at the next interval, so that a grant that can not be reverted
+// does not hold up the others.
+func (d *Fastly) ExpireGrantsEvery(ctx context.Context, interval time.Duration) {
+	l := ctxzap.Extract(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.ExpireGrants(ctx); err != nil {
+				l.Error("baton-fastly: failed to expire grants", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ExpireGrants reverts the time-bound grants that have expired, and returns how many were reverted.
+func (d *Fastly) ExpireGrants(ctx context.Context) (int, error) {
+	if d.grants == nil {
+		return 0, fmt.Errorf("baton-fastly: a grant state file is required to expire grants")
+	}
+
+	reverted, err := d.grants.expire(ctx, d.accounts, time.Now())
+
+	return len(reverted), err
+}
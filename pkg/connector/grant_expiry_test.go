@@ -0,0 +1,449 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+)
+
+func newTestTimeBoundGrants(t *testing.T) *timeBoundGrants {
+	grants, err := newTimeBoundGrants(nil, filepath.Join(t.TempDir(), "grants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return grants
+}
+
+func TestTimeBoundGrantsRecord(t *testing.T) {
+	grantedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	earlier := grantedAt.Add(time.Hour)
+	later := grantedAt.Add(2 * time.Hour)
+
+	tests := []struct {
+		name         string
+		existing     *elevation
+		elevation    *elevation
+		wantRecorded bool
+		wantPrevious string
+		wantGranted  time.Time
+		wantExpires  time.Time
+	}{
+		{
+			name:         "new elevation",
+			elevation:    &elevation{Kind: elevationKindRole, Previous: "user", Elevated: "superuser", GrantedAt: grantedAt, ExpiresAt: earlier},
+			wantRecorded: true,
+			wantPrevious: "user",
+			wantGranted:  grantedAt,
+			wantExpires:  earlier,
+		},
+		{
+			name:      "already held permanently",
+			elevation: &elevation{Kind: elevationKindService, ServiceID: "svc", Previous: "full", Elevated: "full", GrantedAt: grantedAt, ExpiresAt: earlier},
+		},
+		{
+			name:         "elevated again keeps the state before the first elevation",
+			existing:     &elevation{Kind: elevationKindRole, Previous: "user", Elevated: "engineer", GrantedAt: grantedAt, ExpiresAt: earlier},
+			elevation:    &elevation{Kind: elevationKindRole, Previous: "engineer", Elevated: "superuser", GrantedAt: grantedAt.Add(time.Minute), ExpiresAt: later},
+			wantRecorded: true,
+			wantPrevious: "user",
+			wantGranted:  grantedAt,
+			wantExpires:  later,
+		},
+		{
+			name:         "elevated again for less time keeps the later expiry",
+			existing:     &elevation{Kind: elevationKindService, ServiceID: "svc", Previous: "", Elevated: "full", GrantedAt: grantedAt, ExpiresAt: later},
+			elevation:    &elevation{Kind: elevationKindService, ServiceID: "svc", Previous: "full", Elevated: "full", GrantedAt: grantedAt.Add(time.Minute), ExpiresAt: earlier},
+			wantRecorded: true,
+			wantPrevious: "",
+			wantGranted:  grantedAt,
+			wantExpires:  later,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			grants := newTestTimeBoundGrants(t)
+
+			if tt.existing != nil {
+				tt.existing.CustomerID, tt.existing.UserID = "cust", "u1"
+				if _, err := grants.record(tt.existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tt.elevation.CustomerID, tt.elevation.UserID = "cust", "u1"
+			recorded, err := grants.record(tt.elevation)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (recorded != nil) != tt.wantRecorded {
+				t.Fatalf("recorded = %v, want %v", recorded != nil, tt.wantRecorded)
+			}
+
+			active, err := grants.active()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stored, ok := active[tt.elevation.key()]
+			if ok != tt.wantRecorded {
+				t.Fatalf("stored = %v, want %v", ok, tt.wantRecorded)
+			}
+
+			if !tt.wantRecorded {
+				return
+			}
+
+			if stored.Previous != tt.wantPrevious {
+				t.Errorf("previous = %q, want %q", stored.Previous, tt.wantPrevious)
+			}
+
+			if !stored.GrantedAt.Equal(tt.wantGranted) {
+				t.Errorf("granted at = %v, want %v", stored.GrantedAt, tt.wantGranted)
+			}
+
+			if !stored.ExpiresAt.Equal(tt.wantExpires) {
+				t.Errorf("expires at = %v, want %v", stored.ExpiresAt, tt.wantExpires)
+			}
+		})
+	}
+}
+
+func TestRevertElevation(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup sets the state of the account when the elevation expires.
+		setup       func(f *fakeFastly)
+		elevation   *elevation
+		wantChanged bool
+		wantErr     bool
+		// check verifies the state of the account after the elevation was reverted.
+		check func(t *testing.T, f *fakeFastly)
+	}{
+		{
+			name:        "role restored",
+			setup:       func(f *fakeFastly) { f.addUser("u1", "alice", "superuser") },
+			elevation:   &elevation{Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "superuser"},
+			wantChanged: true,
+			check: func(t *testing.T, f *fakeFastly) {
+				if role := f.user("u1").role; role != "engineer" {
+					t.Errorf("role = %q, want engineer", role)
+				}
+			},
+		},
+		{
+			name:      "role changed since",
+			setup:     func(f *fakeFastly) { f.addUser("u1", "alice", "billing") },
+			elevation: &elevation{Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "superuser"},
+			check: func(t *testing.T, f *fakeFastly) {
+				if role := f.user("u1").role; role != "billing" {
+					t.Errorf("role = %q, want billing", role)
+				}
+			},
+		},
+		{
+			name:      "user deleted since",
+			setup:     func(f *fakeFastly) {},
+			elevation: &elevation{Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "superuser"},
+		},
+		{
+			name: "role restore fails",
+			setup: func(f *fakeFastly) {
+				f.addUser("u1", "alice", "superuser")
+				f.failures["PUT /user/u1"] = http.StatusInternalServerError
+			},
+			elevation: &elevation{Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "superuser"},
+			wantErr:   true,
+		},
+		{
+			name: "IAM role removed",
+			setup: func(f *fakeFastly) {
+				f.addUser("u1", "alice", "engineer")
+				f.userRoles["u1"] = []string{"r1", "r2"}
+			},
+			elevation:   &elevation{Kind: elevationKindIAMRole, UserID: "u1", Entitlement: "r2", Elevated: "r2"},
+			wantChanged: true,
+			check: func(t *testing.T, f *fakeFastly) {
+				if roles := f.roles("u1"); len(roles) != 1 || roles[0] != "r1" {
+					t.Errorf("roles = %v, want [r1]", roles)
+				}
+			},
+		},
+		{
+			name: "IAM role held before the elevation",
+			setup: func(f *fakeFastly) {
+				f.addUser("u1", "alice", "engineer")
+				f.userRoles["u1"] = []string{"r2"}
+			},
+			elevation: &elevation{Kind: elevationKindIAMRole, UserID: "u1", Entitlement: "r2", Previous: "r2", Elevated: "r2"},
+			check: func(t *testing.T, f *fakeFastly) {
+				if roles := f.roles("u1"); len(roles) != 1 || roles[0] != "r2" {
+					t.Errorf("roles = %v, want [r2]", roles)
+				}
+			},
+		},
+		{
+			name:      "IAM role removed since",
+			setup:     func(f *fakeFastly) { f.addUser("u1", "alice", "engineer") },
+			elevation: &elevation{Kind: elevationKindIAMRole, UserID: "u1", Entitlement: "r2", Elevated: "r2"},
+		},
+		{
+			name: "service authorization deleted",
+			setup: func(f *fakeFastly) {
+				f.addUser("u1", "alice", "engineer")
+				f.addAuthorization("svc", "u1", "full")
+			},
+			elevation:   &elevation{Kind: elevationKindService, UserID: "u1", ServiceID: "svc", Elevated: "full"},
+			wantChanged: true,
+			check: func(t *testing.T, f *fakeFastly) {
+				if permission := f.permission("svc", "u1"); permission != "" {
+					t.Errorf("permission = %q, want none", permission)
+				}
+			},
+		},
+		{
+			name: "service permission restored",
+			setup: func(f *fakeFastly) {
+				f.addUser("u1", "alice", "engineer")
+				f.addAuthorization("svc", "u1", "full")
+			},
+			elevation:   &elevation{Kind: elevationKindService, UserID: "u1", ServiceID: "svc", Previous: "read_only", Elevated: "full"},
+			wantChanged: true,
+			check: func(t *testing.T, f *fakeFastly) {
+				if permission := f.permission("svc", "u1"); permission != "read_only" {
+					t.Errorf("permission = %q, want read_only", permission)
+				}
+			},
+		},
+		{
+			name: "service permission changed since",
+			setup: func(f *fakeFastly) {
+				f.addUser("u1", "alice", "engineer")
+				f.addAuthorization("svc", "u1", "purge_all")
+			},
+			elevation: &elevation{Kind: elevationKindService, UserID: "u1", ServiceID: "svc", Previous: "read_only", Elevated: "full"},
+			check: func(t *testing.T, f *fakeFastly) {
+				if permission := f.permission("svc", "u1"); permission != "purge_all" {
+					t.Errorf("permission = %q, want purge_all", permission)
+				}
+			},
+		},
+		{
+			name:      "unknown kind",
+			setup:     func(f *fakeFastly) {},
+			elevation: &elevation{Kind: "team", UserID: "u1"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeFastly(t, "cust")
+			tt.setup(f)
+
+			changed, err := revertElevation(f.client(), tt.elevation)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
+
+func TestTimeBoundGrantsExpire(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		elevations []*elevation
+		failures   map[string]int
+		wantErr    bool
+		// wantReverted are the users whose elevation was reverted.
+		wantReverted []string
+		// wantKept are the users whose elevation is still in the state file.
+		wantKept []string
+	}{
+		{
+			name: "expired elevations are reverted",
+			elevations: []*elevation{
+				{CustomerID: "cust", Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "superuser", ExpiresAt: now},
+				{CustomerID: "cust", Kind: elevationKindService, UserID: "u2", ServiceID: "svc", Elevated: "full", ExpiresAt: now.Add(-time.Hour)},
+			},
+			wantReverted: []string{"u1", "u2"},
+		},
+		{
+			name: "elevations that have not expired are kept",
+			elevations: []*elevation{
+				{CustomerID: "cust", Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "superuser", ExpiresAt: now.Add(time.Minute)},
+			},
+			wantKept: []string{"u1"},
+		},
+		{
+			name: "elevations changed since are dropped",
+			elevations: []*elevation{
+				{CustomerID: "cust", Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "billing", ExpiresAt: now},
+			},
+		},
+		{
+			name: "elevations of accounts that are not synced are kept",
+			elevations: []*elevation{
+				{CustomerID: "other", Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "superuser", ExpiresAt: now},
+			},
+			wantKept: []string{"u1"},
+		},
+		{
+			name: "elevations that fail to revert are kept",
+			elevations: []*elevation{
+				{CustomerID: "cust", Kind: elevationKindRole, UserID: "u1", Previous: "engineer", Elevated: "superuser", ExpiresAt: now},
+				{CustomerID: "cust", Kind: elevationKindService, UserID: "u2", ServiceID: "svc", Elevated: "full", ExpiresAt: now},
+			},
+			failures:     map[string]int{"PUT /user/u1": http.StatusInternalServerError},
+			wantErr:      true,
+			wantReverted: []string{"u2"},
+			wantKept:     []string{"u1"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeFastly(t, "cust")
+			f.addUser("u1", "alice", "superuser")
+			f.addUser("u2", "bob", "engineer")
+			f.addAuthorization("svc", "u2", "full")
+			for key, status := range tt.failures {
+				f.failures[key] = status
+			}
+
+			grants := newTestTimeBoundGrants(t)
+			for _, e := range tt.elevations {
+				if _, err := grants.record(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			accounts := []*account{{client: f.client(), customerId: "cust"}}
+			reverted, err := grants.expire(context.Background(), accounts, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			var revertedUsers []string
+			for _, e := range reverted {
+				revertedUsers = append(revertedUsers, e.UserID)
+			}
+			sort.Strings(revertedUsers)
+
+			if !equalStrings(revertedUsers, tt.wantReverted) {
+				t.Errorf("reverted = %v, want %v", revertedUsers, tt.wantReverted)
+			}
+
+			active, err := grants.active()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keptUsers []string
+			for _, e := range active {
+				keptUsers = append(keptUsers, e.UserID)
+			}
+			sort.Strings(keptUsers)
+
+			if !equalStrings(keptUsers, tt.wantKept) {
+				t.Errorf("kept = %v, want %v", keptUsers, tt.wantKept)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestTimeBoundGrantRecordedBeforeGrant(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.addUser("u-alice", "alice", "engineer")
+	client := f.client()
+
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "u-alice"}}
+	superuser := &v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: superUserRole}}
+	service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc-a"}}
+
+	// The state file can not be written, so nothing may be granted.
+	unwritable, err := newTimeBoundGrants(map[string]time.Duration{AnyEntitlement: time.Hour}, filepath.Join(t.TempDir(), "missing", "grants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := newRoleBuilder(client, "cust", false, unwritable)
+	if _, err := roles.Grant(context.Background(), user, ent.NewAssignmentEntitlement(superuser, assignedEntitlement)); err == nil {
+		t.Error("role Grant succeeded without a state file")
+	}
+
+	services := newServiceBuilder(client, "cust", nil, false, unwritable, newSyncCache(client, "cust"))
+	if _, err := services.Grant(context.Background(), user, ent.NewAssignmentEntitlement(service, fullAccessEntitlement)); err == nil {
+		t.Error("service Grant succeeded without a state file")
+	}
+
+	if role := f.user("u-alice").role; role != "engineer" {
+		t.Errorf("role = %q, want engineer", role)
+	}
+
+	if permission := f.permission("svc-a", "u-alice"); permission != "" {
+		t.Errorf("permission = %q, want none", permission)
+	}
+
+	// The grant fails after the elevation is recorded, which then expires without touching the user.
+	grants := newTestTimeBoundGrants(t)
+	grants.durations = map[string]time.Duration{AnyEntitlement: time.Hour}
+	f.failures[http.MethodPut+" /user/u-alice"] = http.StatusInternalServerError
+
+	roles = newRoleBuilder(client, "cust", false, grants)
+	if _, err := roles.Grant(context.Background(), user, ent.NewAssignmentEntitlement(superuser, assignedEntitlement)); err == nil {
+		t.Fatal("role Grant succeeded, want the error of the API")
+	}
+
+	delete(f.failures, http.MethodPut+" /user/u-alice")
+
+	a := &account{client: client, customerId: "cust"}
+	reverted, err := grants.expire(context.Background(), []*account{a}, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reverted) != 0 {
+		t.Errorf("reverted %d grants, want none", len(reverted))
+	}
+
+	if n := f.countRequests(http.MethodPut, "/user/u-alice"); n != 1 {
+		t.Errorf("the user was updated %d times, want only by the failed grant", n)
+	}
+}
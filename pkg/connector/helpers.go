@@ -2,6 +2,7 @@ package connector
 
 import (
 	"fmt"
+	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -17,3 +18,22 @@ func getSkippEntitlementsAndGrantsAnnotations() annotations.Annotations {
 
 	return annotations
 }
+
+// addTimeToProfile sets the key to the RFC 3339 representation of t, if t is set.
+func addTimeToProfile(profile map[string]interface{}, key string, t *time.Time) {
+	if t == nil || t.IsZero() {
+		return
+	}
+
+	profile[key] = t.UTC().Format(time.RFC3339)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,249 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+// The go-fastly v8 client has no support for the IAM endpoints, so they are called
+// directly through the client's generic request methods.
+
+const iamPageSize = 100
+
+type iamMeta struct {
+	CurrentPage int `json:"current_page"`
+	PerPage     int `json:"per_page"`
+	RecordCount int `json:"record_count"`
+	TotalPages  int `json:"total_pages"`
+}
+
+type iamListResponse[T any] struct {
+	Data []T     `json:"data"`
+	Meta iamMeta `json:"meta"`
+}
+
+type iamUserGroup struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+type iamMember struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+	Login  string `json:"login"`
+	Name   string `json:"name"`
+}
+
+type iamRole struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type iamPermission struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type iamServiceGroup struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type iamService struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type iamServiceGroupReference struct {
+	ID string `json:"id"`
+}
+
+type iamServiceGroupsRequest struct {
+	ServiceGroups []iamServiceGroupReference `json:"service_groups"`
+}
+
+type iamRoleReference struct {
+	ID string `json:"id"`
+}
+
+type iamRolesRequest struct {
+	Roles []iamRoleReference `json:"roles"`
+}
+
+type iamMemberReference struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+}
+
+type iamMembersRequest struct {
+	Members []iamMemberReference `json:"members"`
+}
+
+// isNotFoundError returns true if the API responded with 404, which the IAM endpoints
+// do for accounts that have not been migrated to IAM.
+func isNotFoundError(err error) bool {
+	var httpErr *fastly.HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+
+	return httpErr.StatusCode == http.StatusNotFound
+}
+
+// iamList fetches every page of an IAM collection.
+func iamList[T any](client *fastly.Client, path string) ([]T, error) {
+	var rv []T
+
+	for page := 1; ; page++ {
+		resp, err := client.Get(path, &fastly.RequestOptions{
+			Params: map[string]string{
+				"page":     strconv.Itoa(page),
+				"per_page": strconv.Itoa(iamPageSize),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var body iamListResponse[T]
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s response: %w", path, err)
+		}
+
+		rv = append(rv, body.Data...)
+
+		if page >= body.Meta.TotalPages || len(body.Data) == 0 {
+			break
+		}
+	}
+
+	return rv, nil
+}
+
+func iamRequest(client *fastly.Client, method, path string, body interface{}) error {
+	resp, err := client.RequestJSON(method, path, body, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func listRoles(client *fastly.Client) ([]iamRole, error) {
+	return iamList[iamRole](client, "/roles")
+}
+
+func listRolePermissions(client *fastly.Client, roleId string) ([]iamPermission, error) {
+	return iamList[iamPermission](client, fmt.Sprintf("/roles/%s/permissions", roleId))
+}
+
+func listUserRoles(client *fastly.Client, userId string) ([]iamRole, error) {
+	return iamList[iamRole](client, fmt.Sprintf("/users/%s/roles", userId))
+}
+
+func addUserRole(client *fastly.Client, userId, roleId string) error {
+	return iamRequest(client, http.MethodPost, fmt.Sprintf("/users/%s/roles", userId), &iamRolesRequest{
+		Roles: []iamRoleReference{{ID: roleId}},
+	})
+}
+
+func removeUserRole(client *fastly.Client, userId, roleId string) error {
+	return iamRequest(client, http.MethodDelete, fmt.Sprintf("/users/%s/roles", userId), &iamRolesRequest{
+		Roles: []iamRoleReference{{ID: roleId}},
+	})
+}
+
+// userHasRole returns true if the IAM role is assigned to the user.
+func userHasRole(client *fastly.Client, userId, roleId string) (bool, error) {
+	roles, err := listUserRoles(client, userId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if role.ID == roleId {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func listUserGroups(client *fastly.Client) ([]iamUserGroup, error) {
+	return iamList[iamUserGroup](client, "/user-groups")
+}
+
+func listUserGroupMembers(client *fastly.Client, userGroupId string) ([]iamMember, error) {
+	return iamList[iamMember](client, fmt.Sprintf("/user-groups/%s/members", userGroupId))
+}
+
+func listUserGroupRoles(client *fastly.Client, userGroupId string) ([]iamRole, error) {
+	return iamList[iamRole](client, fmt.Sprintf("/user-groups/%s/roles", userGroupId))
+}
+
+func listUserGroupServiceGroups(client *fastly.Client, userGroupId string) ([]iamServiceGroup, error) {
+	return iamList[iamServiceGroup](client, fmt.Sprintf("/user-groups/%s/service-groups", userGroupId))
+}
+
+func addUserGroupMember(client *fastly.Client, userGroupId, userId string) error {
+	return iamRequest(client, http.MethodPost, fmt.Sprintf("/user-groups/%s/members", userGroupId), &iamMembersRequest{
+		Members: []iamMemberReference{{ID: userId, Object: "user"}},
+	})
+}
+
+func removeUserGroupMember(client *fastly.Client, userGroupId, userId string) error {
+	return iamRequest(client, http.MethodDelete, fmt.Sprintf("/user-groups/%s/members", userGroupId), &iamMembersRequest{
+		Members: []iamMemberReference{{ID: userId, Object: "user"}},
+	})
+}
+
+func listServiceGroups(client *fastly.Client) ([]iamServiceGroup, error) {
+	return iamList[iamServiceGroup](client, "/service-groups")
+}
+
+func listServiceGroupServices(client *fastly.Client, serviceGroupId string) ([]iamService, error) {
+	return iamList[iamService](client, fmt.Sprintf("/service-groups/%s/services", serviceGroupId))
+}
+
+func listUserServiceGroups(client *fastly.Client, userId string) ([]iamServiceGroup, error) {
+	return iamList[iamServiceGroup](client, fmt.Sprintf("/users/%s/service-groups", userId))
+}
+
+func addUserServiceGroup(client *fastly.Client, userId, serviceGroupId string) error {
+	return iamRequest(client, http.MethodPost, fmt.Sprintf("/users/%s/service-groups", userId), &iamServiceGroupsRequest{
+		ServiceGroups: []iamServiceGroupReference{{ID: serviceGroupId}},
+	})
+}
+
+func removeUserServiceGroup(client *fastly.Client, userId, serviceGroupId string) error {
+	return iamRequest(client, http.MethodDelete, fmt.Sprintf("/users/%s/service-groups", userId), &iamServiceGroupsRequest{
+		ServiceGroups: []iamServiceGroupReference{{ID: serviceGroupId}},
+	})
+}
+
+func addUserGroupServiceGroup(client *fastly.Client, userGroupId, serviceGroupId string) error {
+	return iamRequest(client, http.MethodPost, fmt.Sprintf("/user-groups/%s/service-groups", userGroupId), &iamServiceGroupsRequest{
+		ServiceGroups: []iamServiceGroupReference{{ID: serviceGroupId}},
+	})
+}
+
+func removeUserGroupServiceGroup(client *fastly.Client, userGroupId, serviceGroupId string) error {
+	return iamRequest(client, http.MethodDelete, fmt.Sprintf("/user-groups/%s/service-groups", userGroupId), &iamServiceGroupsRequest{
+		ServiceGroups: []iamServiceGroupReference{{ID: serviceGroupId}},
+	})
+}
@@ -0,0 +1,256 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// The go-fastly v8 client has no support for invitations, so the JSON:API
+// endpoints are called directly.
+
+const jsonAPIContentType = "application/vnd.api+json"
+
+type invitationAttributes struct {
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	LimitServices bool       `json:"limit_services,omitempty"`
+	InvitedBy     string     `json:"invited_by,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+}
+
+type jsonAPIRelationship struct {
+	Data struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"data"`
+}
+
+type invitation struct {
+	ID            string                         `json:"id,omitempty"`
+	Type          string                         `json:"type"`
+	Attributes    invitationAttributes           `json:"attributes"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships,omitempty"`
+}
+
+type invitationsResponse struct {
+	Data  []invitation `json:"data"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+type invitationRequest struct {
+	Data invitation `json:"data"`
+}
+
+func listInvitations(client *fastly.Client) ([]invitation, error) {
+	var rv []invitation
+
+	for page := 1; ; page++ {
+		resp, err := client.Get("/invitations", &fastly.RequestOptions{
+			Headers: map[string]string{"Accept": jsonAPIContentType},
+			Params: map[string]string{
+				"page[number]": strconv.Itoa(page),
+				"page[size]":   strconv.Itoa(resourcePageSize),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var body invitationsResponse
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode invitations response: %w", err)
+		}
+
+		rv = append(rv, body.Data...)
+
+		if body.Links.Next == "" || len(body.Data) == 0 {
+			break
+		}
+	}
+
+	return rv, nil
+}
+
+func createInvitation(client *fastly.Client, customerId, email, role string) (*invitation, error) {
+	customer := jsonAPIRelationship{}
+	customer.Data.ID = customerId
+	customer.Data.Type = "customer"
+
+	body, err := json.Marshal(&invitationRequest{
+		Data: invitation{
+			Type: "invitation",
+			Attributes: invitationAttributes{
+				Email: email,
+				Role:  role,
+			},
+			Relationships: map[string]jsonAPIRelationship{"customer": customer},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Request(http.MethodPost, "/invitations", &fastly.RequestOptions{
+		Body:       bytes.NewReader(body),
+		BodyLength: int64(len(body)),
+		Headers: map[string]string{
+			"Accept":       jsonAPIContentType,
+			"Content-Type": jsonAPIContentType,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var created invitationRequest
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return nil, fmt.Errorf("failed to decode invitation response: %w", err)
+	}
+
+	return &created.Data, nil
+}
+
+func deleteInvitation(client *fastly.Client, invitationId string) error {
+	resp, err := client.Delete(fmt.Sprintf("/invitations/%s", invitationId), nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+type invitationBuilder struct {
+	resourceType *v2.ResourceType
+	client       *fastly.Client
+	customerId   string
+}
+
+func (o *invitationBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return invitationResourceType
+}
+
+func newInvitationResource(ctx context.Context, invitation invitation) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"email":          invitation.Attributes.Email,
+		"role":           invitation.Attributes.Role,
+		"limit_services": invitation.Attributes.LimitServices,
+	}
+
+	if invitation.Attributes.InvitedBy != "" {
+		profile["invited_by"] = invitation.Attributes.InvitedBy
+	}
+
+	addTimeToProfile(profile, "sent_at", invitation.Attributes.CreatedAt)
+
+	appTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	resource, err := rs.NewAppResource(invitation.Attributes.Email, invitationResourceType, invitation.ID, appTraitOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns all pending invitations of the account.
+func (o *invitationBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	invitations, err := listInvitations(o.client)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error listing invitations")
+	}
+
+	var resources []*v2.Resource
+	for _, invitation := range invitations {
+		resource, err := newInvitationResource(ctx, invitation)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating invitation resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *invitationBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+
+	assigmentOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(invitationResourceType),
+		ent.WithDescription(fmt.Sprintf("Invitation of %s is pending", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s invitation %s", resource.DisplayName, pendingEntitlement)),
+	}
+	rv = append(rv, ent.NewAssignmentEntitlement(resource, pendingEntitlement, assigmentOptions...))
+
+	return rv, "", nil, nil
+}
+
+// Grants returns the pending grant of the invitation to itself, so that revoking it cancels the invitation.
+func (o *invitationBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return []*v2.Grant{grant.NewGrant(resource, pendingEntitlement, resource.Id)}, "", nil, nil
+}
+
+func (o *invitationBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	err := fmt.Errorf("baton-fastly: invitations cannot be granted, create them through account provisioning")
+
+	l.Warn(
+		err.Error(),
+		zap.String("principal_id", principal.Id.Resource),
+		zap.String("principal_type", principal.Id.ResourceType),
+	)
+
+	return nil, err
+}
+
+// Revoke cancels the invitation.
+func (o *invitationBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	invitationId := grant.Entitlement.Resource.Id.Resource
+
+	err := deleteInvitation(o.client, invitationId)
+	if err != nil {
+		err = wrapError(err, "failed to cancel invitation")
+
+		l.Error(
+			err.Error(),
+			zap.String("invitation_id", invitationId),
+		)
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func newInvitationBuilder(client *fastly.Client, customerId string) *invitationBuilder {
+	return &invitationBuilder{
+		resourceType: invitationResourceType,
+		client:       client,
+		customerId:   customerId,
+	}
+}
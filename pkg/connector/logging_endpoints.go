@@ -0,0 +1,819 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+// loggingEndpoint is the provider independent view of a logging endpoint.
+// Credentials are never copied into it, only whether one is configured.
+type loggingEndpoint struct {
+	provider    string
+	name        string
+	destination string
+	hasSecret   bool
+	serviceId   string
+	version     int
+	createdAt   *time.Time
+	updatedAt   *time.Time
+}
+
+type loggingEndpointLister func(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error)
+
+// loggingEndpointListers holds a lister for every logging provider supported by the Fastly client.
+var loggingEndpointListers = []struct {
+	provider string
+	list     loggingEndpointLister
+}{
+	{"bigquery", listBigQueryEndpoints},
+	{"blobstorage", listBlobStorageEndpoints},
+	{"cloudfiles", listCloudfilesEndpoints},
+	{"datadog", listDatadogEndpoints},
+	{"digitalocean", listDigitalOceanEndpoints},
+	{"elasticsearch", listElasticsearchEndpoints},
+	{"ftp", listFTPEndpoints},
+	{"gcs", listGCSEndpoints},
+	{"heroku", listHerokuEndpoints},
+	{"honeycomb", listHoneycombEndpoints},
+	{"https", listHTTPSEndpoints},
+	{"kafka", listKafkaEndpoints},
+	{"kinesis", listKinesisEndpoints},
+	{"logentries", listLogentriesEndpoints},
+	{"loggly", listLogglyEndpoints},
+	{"logshuttle", listLogshuttleEndpoints},
+	{"newrelic", listNewRelicEndpoints},
+	{"newrelicotlp", listNewRelicOTLPEndpoints},
+	{"openstack", listOpenstackEndpoints},
+	{"papertrail", listPapertrailEndpoints},
+	{"pubsub", listPubsubEndpoints},
+	{"s3", listS3Endpoints},
+	{"scalyr", listScalyrEndpoints},
+	{"sftp", listSFTPEndpoints},
+	{"splunk", listSplunkEndpoints},
+	{"sumologic", listSumologicEndpoints},
+	{"syslog", listSyslogEndpoints},
+}
+
+// anySet returns true if at least one of the values is not empty.
+func anySet(values ...string) bool {
+	for _, value := range values {
+		if value != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// urlHost returns the host of the URL so that credentials embedded in the URL are not exported.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	return u.Host
+}
+
+func listBigQueryEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListBigQueries(&fastly.ListBigQueriesInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "bigquery",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s.%s.%s", item.ProjectID, item.Dataset, item.Table),
+			hasSecret:   anySet(item.SecretKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listBlobStorageEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListBlobStorages(&fastly.ListBlobStoragesInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "blobstorage",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s/%s", item.AccountName, item.Container),
+			hasSecret:   anySet(item.SASToken),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listCloudfilesEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListCloudfiles(&fastly.ListCloudfilesInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "cloudfiles",
+			name:        item.Name,
+			destination: item.BucketName,
+			hasSecret:   anySet(item.AccessKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listDatadogEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListDatadog(&fastly.ListDatadogInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "datadog",
+			name:        item.Name,
+			destination: item.Region,
+			hasSecret:   anySet(item.Token),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listDigitalOceanEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListDigitalOceans(&fastly.ListDigitalOceansInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "digitalocean",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s/%s", item.Domain, item.BucketName),
+			hasSecret:   anySet(item.AccessKey, item.SecretKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listElasticsearchEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListElasticsearch(&fastly.ListElasticsearchInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "elasticsearch",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s/%s", urlHost(item.URL), item.Index),
+			hasSecret:   anySet(item.Password, item.TLSClientKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listFTPEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListFTPs(&fastly.ListFTPsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "ftp",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s:%d", item.Address, item.Port),
+			hasSecret:   anySet(item.Password),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listGCSEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListGCSs(&fastly.ListGCSsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "gcs",
+			name:        item.Name,
+			destination: item.Bucket,
+			hasSecret:   anySet(item.SecretKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listHerokuEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListHerokus(&fastly.ListHerokusInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "heroku",
+			name:        item.Name,
+			destination: urlHost(item.URL),
+			hasSecret:   anySet(item.Token),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listHoneycombEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListHoneycombs(&fastly.ListHoneycombsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "honeycomb",
+			name:        item.Name,
+			destination: item.Dataset,
+			hasSecret:   anySet(item.Token),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listHTTPSEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListHTTPS(&fastly.ListHTTPSInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "https",
+			name:        item.Name,
+			destination: urlHost(item.URL),
+			hasSecret:   anySet(item.HeaderValue, item.TLSClientKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listKafkaEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListKafkas(&fastly.ListKafkasInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "kafka",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s/%s", item.Brokers, item.Topic),
+			hasSecret:   anySet(item.Password, item.TLSClientKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listKinesisEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListKinesis(&fastly.ListKinesisInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "kinesis",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s/%s", item.Region, item.StreamName),
+			hasSecret:   anySet(item.AccessKey, item.SecretKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listLogentriesEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListLogentries(&fastly.ListLogentriesInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "logentries",
+			name:        item.Name,
+			destination: item.Region,
+			hasSecret:   anySet(item.Token),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listLogglyEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListLoggly(&fastly.ListLogglyInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:  "loggly",
+			name:      item.Name,
+			hasSecret: anySet(item.Token),
+			serviceId: serviceId,
+			version:   version,
+			createdAt: item.CreatedAt,
+			updatedAt: item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listLogshuttleEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListLogshuttles(&fastly.ListLogshuttlesInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "logshuttle",
+			name:        item.Name,
+			destination: urlHost(item.URL),
+			hasSecret:   anySet(item.Token),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listNewRelicEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListNewRelic(&fastly.ListNewRelicInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "newrelic",
+			name:        item.Name,
+			destination: item.Region,
+			hasSecret:   anySet(item.Token),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listNewRelicOTLPEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListNewRelicOTLP(&fastly.ListNewRelicOTLPInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		destination := urlHost(item.URL)
+		if destination == "" {
+			destination = item.Region
+		}
+
+		rv = append(rv, &loggingEndpoint{
+			provider:    "newrelicotlp",
+			name:        item.Name,
+			destination: destination,
+			hasSecret:   anySet(item.Token),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listOpenstackEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListOpenstack(&fastly.ListOpenstackInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "openstack",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s/%s", urlHost(item.URL), item.BucketName),
+			hasSecret:   anySet(item.AccessKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listPapertrailEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListPapertrails(&fastly.ListPapertrailsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "papertrail",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s:%d", item.Address, item.Port),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listPubsubEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListPubsubs(&fastly.ListPubsubsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "pubsub",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s/%s", item.ProjectID, item.Topic),
+			hasSecret:   anySet(item.SecretKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listS3Endpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListS3s(&fastly.ListS3sInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "s3",
+			name:        item.Name,
+			destination: item.BucketName,
+			hasSecret:   anySet(item.AccessKey, item.SecretKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listScalyrEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListScalyrs(&fastly.ListScalyrsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "scalyr",
+			name:        item.Name,
+			destination: item.Region,
+			hasSecret:   anySet(item.Token),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listSFTPEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListSFTPs(&fastly.ListSFTPsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "sftp",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s:%d", item.Address, item.Port),
+			hasSecret:   anySet(item.Password, item.SecretKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listSplunkEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListSplunks(&fastly.ListSplunksInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "splunk",
+			name:        item.Name,
+			destination: urlHost(item.URL),
+			hasSecret:   anySet(item.Token, item.TLSClientKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+// Sumo Logic collector URLs embed the collector token, so their presence counts as a secret.
+func listSumologicEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListSumologics(&fastly.ListSumologicsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "sumologic",
+			name:        item.Name,
+			destination: urlHost(item.URL),
+			hasSecret:   anySet(item.URL),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+func listSyslogEndpoints(client *fastly.Client, serviceId string, version int) ([]*loggingEndpoint, error) {
+	items, err := client.ListSyslogs(&fastly.ListSyslogsInput{ServiceID: serviceId, ServiceVersion: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*loggingEndpoint
+	for _, item := range items {
+		rv = append(rv, &loggingEndpoint{
+			provider:    "syslog",
+			name:        item.Name,
+			destination: fmt.Sprintf("%s:%d", item.Address, item.Port),
+			hasSecret:   anySet(item.Token, item.TLSClientKey),
+			serviceId:   serviceId,
+			version:     version,
+			createdAt:   item.CreatedAt,
+			updatedAt:   item.UpdatedAt,
+		})
+	}
+
+	return rv, nil
+}
+
+type loggingEndpointBuilder struct {
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+	cache         *syncCache
+}
+
+func (o *loggingEndpointBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return loggingEndpointResourceType
+}
+
+func newLoggingEndpointResource(ctx context.Context, endpoint *loggingEndpoint, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":            endpoint.name,
+		"provider":        endpoint.provider,
+		"service_id":      endpoint.serviceId,
+		"service_version": endpoint.version,
+		"secret_present":  endpoint.hasSecret,
+	}
+
+	if endpoint.destination != "" {
+		profile["destination"] = endpoint.destination
+	}
+
+	addTimeToProfile(profile, "created_at", endpoint.createdAt)
+	addTimeToProfile(profile, "updated_at", endpoint.updatedAt)
+
+	appTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	resource, err := rs.NewAppResource(
+		fmt.Sprintf("%s (%s)", endpoint.name, endpoint.provider),
+		loggingEndpointResourceType,
+		fmt.Sprintf("%s:%s:%s", endpoint.serviceId, endpoint.provider, endpoint.name),
+		appTraitOptions,
+		rs.WithParentResourceID(parentResourceID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns the logging endpoints of every provider configured on the active version of the parent service.
+func (o *loggingEndpointBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	allowed, err := o.serviceFilter.allowsServiceId(o.client, parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error filtering service")
+	}
+
+	if !allowed {
+		return nil, "", nil, nil
+	}
+
+	activeVersion, err := o.cache.activeVersion(parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error getting active service version")
+	}
+
+	if activeVersion == 0 {
+		return nil, "", nil, nil
+	}
+
+	var resources []*v2.Resource
+	for _, lister := range loggingEndpointListers {
+		endpoints, err := lister.list(o.client, parentResourceID.Resource, activeVersion)
+		if err != nil {
+			return nil, "", nil, wrapError(err, fmt.Sprintf("error listing %s logging endpoints", lister.provider))
+		}
+
+		for _, endpoint := range endpoints {
+			resource, err := newLoggingEndpointResource(ctx, endpoint, parentResourceID)
+			if err != nil {
+				return nil, "", nil, wrapError(err, "error creating logging endpoint resource")
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, "", nil, nil
+}
+
+// Entitlements always returns an empty slice for logging endpoints.
+func (o *loggingEndpointBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants always returns an empty slice for logging endpoints since they don't have any entitlements.
+func (o *loggingEndpointBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func newLoggingEndpointBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter, cache *syncCache) *loggingEndpointBuilder {
+	return &loggingEndpointBuilder{
+		resourceType:  loggingEndpointResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+		cache:         cache,
+	}
+}
@@ -0,0 +1,402 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"google.golang.org/protobuf/proto"
+)
+
+// When several accounts are synced, the IDs of all resources except the accounts themselves are
+// prefixed with the customer ID of the account they belong to, e.g. "<customer id>/<user id>".
+const namespaceSeparator = "/"
+
+// account is a Fastly customer account the connector syncs, together with the client authenticated for it.
+type account struct {
+	name       string
+	client     *fastly.Client
+	customerId string
+	// userId is the user the access token belongs to.
+	userId string
+}
+
+func namespaceID(customerId, id string) string {
+	return customerId + namespaceSeparator + id
+}
+
+func splitNamespacedID(id string) (string, string, error) {
+	customerId, rest, ok := strings.Cut(id, namespaceSeparator)
+	if !ok || customerId == "" {
+		return "", "", fmt.Errorf("baton-fastly: resource id %q is not namespaced by account", id)
+	}
+
+	return customerId, rest, nil
+}
+
+func namespaceResourceId(customerId string, id *v2.ResourceId) *v2.ResourceId {
+	if id == nil || id.ResourceType == accountResourceType.Id {
+		return id
+	}
+
+	return &v2.ResourceId{ResourceType: id.ResourceType, Resource: namespaceID(customerId, id.Resource)}
+}
+
+// stripResourceId returns the customer ID a resource ID is namespaced by and the ID without the namespace.
+func stripResourceId(id *v2.ResourceId) (string, *v2.ResourceId, error) {
+	if id.ResourceType == accountResourceType.Id {
+		return id.Resource, id, nil
+	}
+
+	customerId, rest, err := splitNamespacedID(id.Resource)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return customerId, &v2.ResourceId{ResourceType: id.ResourceType, Resource: rest}, nil
+}
+
+// namespaceResource namespaces the resource and its parent. Top level resources stay top level, the
+// account they belong to is part of their ID.
+func namespaceResource(customerId string, resource *v2.Resource) *v2.Resource {
+	rv := proto.Clone(resource).(*v2.Resource)
+	rv.Id = namespaceResourceId(customerId, resource.Id)
+	rv.ParentResourceId = namespaceResourceId(customerId, resource.ParentResourceId)
+
+	return rv
+}
+
+func stripResource(resource *v2.Resource) (string, *v2.Resource, error) {
+	customerId, id, err := stripResourceId(resource.Id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rv := proto.Clone(resource).(*v2.Resource)
+	rv.Id = id
+
+	if parent := resource.ParentResourceId; parent != nil {
+		_, rv.ParentResourceId, err = stripResourceId(parent)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return customerId, rv, nil
+}
+
+// Entitlement IDs are "<resource type>:<resource id>:<slug>", so the namespace goes right after the resource type.
+func namespaceEntitlementId(customerId, id string) string {
+	resourceType, rest, ok := strings.Cut(id, ":")
+	if !ok || resourceType == accountResourceType.Id {
+		return id
+	}
+
+	return resourceType + ":" + namespaceID(customerId, rest)
+}
+
+func stripEntitlementId(customerId, id string) string {
+	resourceType, rest, ok := strings.Cut(id, ":")
+	if !ok {
+		return id
+	}
+
+	return resourceType + ":" + strings.TrimPrefix(rest, customerId+namespaceSeparator)
+}
+
+func namespaceEntitlement(customerId string, entitlement *v2.Entitlement) *v2.Entitlement {
+	rv := proto.Clone(entitlement).(*v2.Entitlement)
+	rv.Id = namespaceEntitlementId(customerId, entitlement.Id)
+	rv.Resource = namespaceResource(customerId, entitlement.Resource)
+
+	return rv
+}
+
+func stripEntitlement(customerId string, entitlement *v2.Entitlement) (*v2.Entitlement, error) {
+	_, resource, err := stripResource(entitlement.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := proto.Clone(entitlement).(*v2.Entitlement)
+	rv.Id = stripEntitlementId(customerId, entitlement.Id)
+	rv.Resource = resource
+
+	return rv, nil
+}
+
+func newGrantId(entitlement *v2.Entitlement, principal *v2.Resource) string {
+	return fmt.Sprintf("%s:%s:%s", entitlement.Id, principal.Id.ResourceType, principal.Id.Resource)
+}
+
+func namespaceGrant(customerId string, g *v2.Grant) (*v2.Grant, error) {
+	rv := proto.Clone(g).(*v2.Grant)
+	rv.Entitlement = namespaceEntitlement(customerId, g.Entitlement)
+	rv.Principal = namespaceResource(customerId, g.Principal)
+	rv.Id = newGrantId(rv.Entitlement, rv.Principal)
+
+	annos := annotations.Annotations(rv.Annotations)
+	expandable := &v2.GrantExpandable{}
+	ok, err := annos.Pick(expandable)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		for i, entitlementId := range expandable.EntitlementIds {
+			expandable.EntitlementIds[i] = namespaceEntitlementId(customerId, entitlementId)
+		}
+
+		annos.Update(expandable)
+		rv.Annotations = annos
+	}
+
+	return rv, nil
+}
+
+func stripGrant(customerId string, g *v2.Grant) (*v2.Grant, error) {
+	entitlement, err := stripEntitlement(customerId, g.Entitlement)
+	if err != nil {
+		return nil, err
+	}
+
+	principalCustomerId, principal, err := stripResource(g.Principal)
+	if err != nil {
+		return nil, err
+	}
+
+	if principalCustomerId != customerId {
+		return nil, fmt.Errorf("baton-fastly: principal and entitlement belong to different accounts")
+	}
+
+	rv := proto.Clone(g).(*v2.Grant)
+	rv.Entitlement = entitlement
+	rv.Principal = principal
+	rv.Id = newGrantId(entitlement, principal)
+
+	return rv, nil
+}
+
+// namespacedSyncer syncs one resource type of several accounts, using one builder per account and
+// namespacing the IDs of everything the builders return by the account's customer ID.
+type namespacedSyncer struct {
+	resourceType *v2.ResourceType
+	accounts     []*account
+	syncers      map[string]connectorbuilder.ResourceSyncer
+}
+
+func (o *namespacedSyncer) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *namespacedSyncer) syncer(customerId string) (connectorbuilder.ResourceSyncer, error) {
+	syncer, ok := o.syncers[customerId]
+	if !ok {
+		return nil, fmt.Errorf("baton-fastly: unknown account %s", customerId)
+	}
+
+	return syncer, nil
+}
+
+func (o *namespacedSyncer) namespaceResources(customerId string, resources []*v2.Resource) []*v2.Resource {
+	rv := make([]*v2.Resource, 0, len(resources))
+	for _, resource := range resources {
+		rv = append(rv, namespaceResource(customerId, resource))
+	}
+
+	return rv
+}
+
+// List lists the children of a parent from the account the parent belongs to. Top level resources
+// are listed from every account in turn, keeping track of the current account in the page token.
+func (o *namespacedSyncer) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID != nil {
+		customerId, parentId, err := stripResourceId(parentResourceID)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		syncer, err := o.syncer(customerId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		resources, nextPage, annos, err := syncer.List(ctx, parentId, pToken)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		return o.namespaceResources(customerId, resources), nextPage, annos, nil
+	}
+
+	bag := &pagination.Bag{}
+	err := bag.Unmarshal(pToken.Token)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if bag.Current() == nil {
+		for i := len(o.accounts) - 1; i >= 0; i-- {
+			bag.Push(pagination.PageState{
+				ResourceTypeID: o.resourceType.Id,
+				ResourceID:     o.accounts[i].customerId,
+			})
+		}
+	}
+
+	customerId := bag.ResourceID()
+	syncer, err := o.syncer(customerId)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	resources, innerNextPage, annos, err := syncer.List(ctx, nil, &pagination.Token{Size: pToken.Size, Token: bag.PageToken()})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	nextPage, err := bag.NextToken(innerNextPage)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return o.namespaceResources(customerId, resources), nextPage, annos, nil
+}
+
+func (o *namespacedSyncer) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	customerId, stripped, err := stripResource(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	syncer, err := o.syncer(customerId)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	entitlements, nextPage, annos, err := syncer.Entitlements(ctx, stripped, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	rv := make([]*v2.Entitlement, 0, len(entitlements))
+	for _, entitlement := range entitlements {
+		rv = append(rv, namespaceEntitlement(customerId, entitlement))
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func (o *namespacedSyncer) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	customerId, stripped, err := stripResource(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	syncer, err := o.syncer(customerId)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	grants, nextPage, annos, err := syncer.Grants(ctx, stripped, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	rv := make([]*v2.Grant, 0, len(grants))
+	for _, g := range grants {
+		namespaced, err := namespaceGrant(customerId, g)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = append(rv, namespaced)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+// namespacedProvisioner routes Grant and Revoke to the builder of the account the entitlement belongs to.
+type namespacedProvisioner struct {
+	*namespacedSyncer
+}
+
+func (o *namespacedProvisioner) provisioner(customerId string) (connectorbuilder.ResourceProvisioner, error) {
+	syncer, err := o.syncer(customerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return syncer.(connectorbuilder.ResourceProvisioner), nil
+}
+
+func (o *namespacedProvisioner) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	customerId, _, err := stripResourceId(entitlement.Resource.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	principalCustomerId, strippedPrincipal, err := stripResource(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	if principalCustomerId != customerId {
+		return nil, fmt.Errorf("baton-fastly: principal and entitlement belong to different accounts")
+	}
+
+	strippedEntitlement, err := stripEntitlement(customerId, entitlement)
+	if err != nil {
+		return nil, err
+	}
+
+	provisioner, err := o.provisioner(customerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return provisioner.Grant(ctx, strippedPrincipal, strippedEntitlement)
+}
+
+func (o *namespacedProvisioner) Revoke(ctx context.Context, g *v2.Grant) (annotations.Annotations, error) {
+	customerId, _, err := stripResourceId(g.Entitlement.Resource.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	stripped, err := stripGrant(customerId, g)
+	if err != nil {
+		return nil, err
+	}
+
+	provisioner, err := o.provisioner(customerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return provisioner.Revoke(ctx, stripped)
+}
+
+// newNamespacedSyncer combines the builders of the same resource type of every account.
+func newNamespacedSyncer(ctx context.Context, accounts []*account, syncers []connectorbuilder.ResourceSyncer) connectorbuilder.ResourceSyncer {
+	rv := &namespacedSyncer{
+		resourceType: syncers[0].ResourceType(ctx),
+		accounts:     accounts,
+		syncers:      make(map[string]connectorbuilder.ResourceSyncer, len(accounts)),
+	}
+
+	for i, account := range accounts {
+		rv.syncers[account.customerId] = syncers[i]
+	}
+
+	if _, ok := syncers[0].(connectorbuilder.ResourceProvisioner); ok {
+		return &namespacedProvisioner{rv}
+	}
+
+	return rv
+}
@@ -0,0 +1,151 @@
+package connector
+
+import (
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNamespaceResourceRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource *v2.Resource
+		wantId   string
+	}{
+		{
+			name:     "top level resource",
+			resource: &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc"}, DisplayName: "Service"},
+			wantId:   "cust/svc",
+		},
+		{
+			name: "child resource",
+			resource: &v2.Resource{
+				Id:               &v2.ResourceId{ResourceType: aclResourceType.Id, Resource: "acl"},
+				ParentResourceId: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc"},
+			},
+			wantId: "cust/acl",
+		},
+		{
+			name:     "ID containing the separator",
+			resource: &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "a/b"}},
+			wantId:   "cust/a/b",
+		},
+		{
+			name:     "account",
+			resource: &v2.Resource{Id: &v2.ResourceId{ResourceType: accountResourceType.Id, Resource: "cust"}},
+			wantId:   "cust",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			namespaced := namespaceResource("cust", tt.resource)
+			if namespaced.Id.Resource != tt.wantId {
+				t.Errorf("namespaced ID = %q, want %q", namespaced.Id.Resource, tt.wantId)
+			}
+
+			if parent := namespaced.ParentResourceId; parent != nil && parent.Resource != namespaceID("cust", tt.resource.ParentResourceId.Resource) {
+				t.Errorf("namespaced parent ID = %q", parent.Resource)
+			}
+
+			customerId, stripped, err := stripResource(namespaced)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if customerId != "cust" {
+				t.Errorf("customer ID = %q, want cust", customerId)
+			}
+
+			if !proto.Equal(stripped, tt.resource) {
+				t.Errorf("stripped = %v, want %v", stripped, tt.resource)
+			}
+		})
+	}
+}
+
+func TestStripResourceIdNotNamespaced(t *testing.T) {
+	for _, id := range []string{"svc", "/svc"} {
+		_, _, err := stripResourceId(&v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: id})
+		if err == nil {
+			t.Errorf("stripResourceId(%q) succeeded, want error", id)
+		}
+	}
+}
+
+func TestNamespaceGrantRoundTrip(t *testing.T) {
+	service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc"}, DisplayName: "Service"}
+	role := &v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: superUserRole}, DisplayName: superUserRole}
+	user := &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "u1"}
+
+	tests := []struct {
+		name  string
+		grant *v2.Grant
+	}{
+		{
+			name:  "user grant",
+			grant: grant.NewGrant(service, "full", user),
+		},
+		{
+			name: "expandable grant",
+			grant: grant.NewGrant(service, accessEntitlement, role.Id, grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{ent.NewEntitlementID(role, assignedEntitlement)},
+			})),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			namespaced, err := namespaceGrant("cust", tt.grant)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantEntitlementId := namespaceEntitlementId("cust", tt.grant.Entitlement.Id)
+			if namespaced.Entitlement.Id != wantEntitlementId {
+				t.Errorf("entitlement ID = %q, want %q", namespaced.Entitlement.Id, wantEntitlementId)
+			}
+
+			if namespaced.Id != newGrantId(namespaced.Entitlement, namespaced.Principal) {
+				t.Errorf("grant ID = %q does not match its entitlement and principal", namespaced.Id)
+			}
+
+			annos := annotations.Annotations(namespaced.Annotations)
+			expandable := &v2.GrantExpandable{}
+			if ok, err := annos.Pick(expandable); err != nil {
+				t.Fatal(err)
+			} else if ok {
+				want := namespaceEntitlementId("cust", ent.NewEntitlementID(role, assignedEntitlement))
+				if len(expandable.EntitlementIds) != 1 || expandable.EntitlementIds[0] != want {
+					t.Errorf("expandable entitlements = %v, want [%s]", expandable.EntitlementIds, want)
+				}
+			}
+
+			stripped, err := stripGrant("cust", namespaced)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Revoke does not need the expandable entitlements, so they stay namespaced.
+			stripped.Annotations = tt.grant.Annotations
+			if !proto.Equal(stripped, tt.grant) {
+				t.Errorf("stripped = %v, want %v", stripped, tt.grant)
+			}
+		})
+	}
+}
+
+func TestStripGrantAcrossAccounts(t *testing.T) {
+	service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "cust/svc"}}
+	g := grant.NewGrant(service, "full", &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "other/u1"})
+
+	if _, err := stripGrant("cust", g); err == nil {
+		t.Error("stripGrant succeeded for a principal of another account, want error")
+	}
+}
@@ -0,0 +1,540 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// UnmanagedIgnore leaves users that are not in the policy alone.
+	UnmanagedIgnore = "ignore"
+	// UnmanagedReport lists users that are not in the policy in the plan without changing them.
+	UnmanagedReport = "report"
+	// UnmanagedDowngrade revokes the role of users that are not in the policy, which leaves them with the User role.
+	UnmanagedDowngrade = "downgrade"
+	// UnmanagedLock locks users that are not in the policy out of the account.
+	UnmanagedLock = "lock"
+)
+
+var unmanagedActions = []string{UnmanagedIgnore, UnmanagedReport, UnmanagedDowngrade, UnmanagedLock}
+
+// Policy is the access to a Fastly account as it should be: the role of every user, and the permission
+// of engineers on services.
+type Policy struct {
+	Users []PolicyUser `yaml:"users"`
+	// Unmanaged are the rules for users of the account that are not in the policy. The first rule
+	// matching the login of a user applies, and users no rule matches are reported.
+	Unmanaged []UnmanagedRule `yaml:"unmanaged"`
+}
+
+// PolicyUser is the access a user should have.
+type PolicyUser struct {
+	Login string `yaml:"login"`
+	Role  string `yaml:"role"`
+	// Services maps service IDs or names to the permission on the service: read_only, purge_select,
+	// purge_all or full. Only engineers have permissions on services.
+	Services map[string]string `yaml:"services"`
+}
+
+// UnmanagedRule is what happens to users that are not in the policy and whose login matches the glob.
+// An empty glob matches every login.
+type UnmanagedRule struct {
+	Match  string `yaml:"match"`
+	Action string `yaml:"action"`
+}
+
+// LoadPolicy reads and validates a YAML policy.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("baton-fastly: failed to read policy: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("baton-fastly: failed to parse policy: %w", err)
+	}
+
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (p *Policy) validate() error {
+	logins := make(map[string]bool, len(p.Users))
+	for _, user := range p.Users {
+		login := strings.ToLower(user.Login)
+		if login == "" {
+			return fmt.Errorf("baton-fastly: policy has a user without login")
+		}
+
+		if logins[login] {
+			return fmt.Errorf("baton-fastly: policy has user %q more than once", user.Login)
+		}
+		logins[login] = true
+
+		if user.Role == "" {
+			return fmt.Errorf("baton-fastly: policy has no role for user %q", user.Login)
+		}
+
+		if _, ok := legacyRoleName(user.Role); !ok {
+			return fmt.Errorf("baton-fastly: policy gives user %q role %q, which is not one of %s", user.Login, user.Role, strings.Join(roles, ", "))
+		}
+
+		if len(user.Services) > 0 && !strings.EqualFold(user.Role, engineerRole) {
+			return fmt.Errorf("baton-fastly: policy gives user %q service permissions, which only engineers can have", user.Login)
+		}
+
+		for service, permission := range user.Services {
+			if _, ok := permissionEntitlementMap[permission]; !ok {
+				return fmt.Errorf("baton-fastly: policy has unknown permission %q on service %q for user %q", permission, service, user.Login)
+			}
+		}
+	}
+
+	for _, rule := range p.Unmanaged {
+		if !containsString(unmanagedActions, rule.Action) {
+			return fmt.Errorf("baton-fastly: unknown action %q for unmanaged users, must be one of %s", rule.Action, strings.Join(unmanagedActions, ", "))
+		}
+
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return fmt.Errorf("baton-fastly: invalid login pattern %q for unmanaged users: %w", rule.Match, err)
+		}
+	}
+
+	return nil
+}
+
+// unmanagedAction returns the action of the first rule matching the login.
+func (p *Policy) unmanagedAction(login string) string {
+	for _, rule := range p.Unmanaged {
+		if rule.Match == "" {
+			return rule.Action
+		}
+
+		if matched, _ := path.Match(strings.ToLower(rule.Match), strings.ToLower(login)); matched {
+			return rule.Action
+		}
+	}
+
+	return UnmanagedReport
+}
+
+// policyChange is a difference between the policy and the account, and how to resolve it.
+type policyChange struct {
+	description string
+	apply       func(ctx context.Context) error
+}
+
+// PolicyPlan is the changes that bring an account in line with a policy.
+type PolicyPlan struct {
+	account *account
+	changes []policyChange
+	notes   []string
+}
+
+// Changes returns the number of changes in the plan.
+func (p *PolicyPlan) Changes() int {
+	return len(p.changes)
+}
+
+// Write writes the plan in a human readable form.
+func (p *PolicyPlan) Write(w io.Writer) error {
+	name := p.account.customerId
+	if p.account.name != "" {
+		name = fmt.Sprintf("%s (%s)", p.account.name, p.account.customerId)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan for account %s:\n", name)
+
+	for _, change := range p.changes {
+		fmt.Fprintf(&b, "  %s\n", change.description)
+	}
+
+	for _, note := range p.notes {
+		fmt.Fprintf(&b, "  ! %s\n", note)
+	}
+
+	if len(p.changes) == 0 {
+		b.WriteString("No changes, the account matches the policy.\n")
+	} else {
+		fmt.Fprintf(&b, "%d changes.\n", len(p.changes))
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// Apply makes the changes of the plan in order, and stops at the first one that fails. Every change
+// that was made is written to w.
+func (p *PolicyPlan) Apply(ctx context.Context, w io.Writer) error {
+	for _, change := range p.changes {
+		if err := change.apply(ctx); err != nil {
+			return fmt.Errorf("baton-fastly: failed to apply %q: %w", change.description, err)
+		}
+
+		if _, err := fmt.Fprintf(w, "applied: %s\n", change.description); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// policyState is the live state of an account as seen by the role and service builders.
+type policyState struct {
+	users       []*fastly.User
+	roles       []*v2.Resource
+	userRoles   map[string]*v2.Resource
+	services    []*v2.Resource
+	permissions map[string]map[string]string
+}
+
+// PlanPolicy compares the named account with the policy, and plans the grants and revokes that make it
+// match. The live state is gathered by the role and service builders, and the plan applies through them.
+func (d *Fastly) PlanPolicy(ctx context.Context, accountName string, policy *Policy) (*PolicyPlan, error) {
+	a, err := d.account(accountName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The policy is the permanent state of the account, so its grants never expire.
+	roles := newRoleBuilder(a.client, a.customerId, d.dryRun, nil)
+	services := newServiceBuilder(a.client, a.customerId, d.serviceFilter, d.dryRun, nil, newSyncCache(a.client, a.customerId))
+
+	state, err := gatherPolicyState(ctx, a, roles, services)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &PolicyPlan{account: a}
+	var removals, roleChanges, serviceChanges []policyChange
+
+	managed := make(map[string]bool, len(policy.Users))
+	usersByLogin := make(map[string]*fastly.User, len(state.users))
+	for _, user := range state.users {
+		usersByLogin[strings.ToLower(user.Login)] = user
+	}
+
+	for _, policyUser := range policy.Users {
+		managed[strings.ToLower(policyUser.Login)] = true
+
+		user, ok := usersByLogin[strings.ToLower(policyUser.Login)]
+		if !ok {
+			plan.notes = append(plan.notes, fmt.Sprintf("%s is in the policy but not a user of the account, use create-account", policyUser.Login))
+			continue
+		}
+
+		principal, err := newUserResource(ctx, user, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		role, err := findPolicyResource(state.roles, policyUser.Role)
+		if err != nil {
+			return nil, fmt.Errorf("baton-fastly: unknown role %q for user %q: %w", policyUser.Role, policyUser.Login, err)
+		}
+
+		current := state.userRoles[user.ID]
+		if current == nil || current.Id.Resource != role.Id.Resource {
+			roleChanges = append(roleChanges, policyChange{
+				description: fmt.Sprintf("~ role of %s: %s -> %s", user.Login, resourceName(current), role.DisplayName),
+				apply: func(ctx context.Context) error {
+					_, err := roles.Grant(ctx, principal, ent.NewAssignmentEntitlement(role, assignedEntitlement))
+					return err
+				},
+			})
+		}
+
+		desired := make(map[string]string, len(policyUser.Services))
+		for key, permission := range policyUser.Services {
+			service, err := findPolicyResource(state.services, key)
+			if err != nil {
+				return nil, fmt.Errorf("baton-fastly: unknown service %q for user %q: %w", key, policyUser.Login, err)
+			}
+
+			desired[service.Id.Resource] = permission
+		}
+
+		for _, service := range state.services {
+			service := service
+			have := state.permissions[service.Id.Resource][user.ID]
+			want := desired[service.Id.Resource]
+
+			switch {
+			case have == want:
+			case want == "":
+				// Only an engineer can lose a service permission, so it happens before the role changes.
+				if !strings.EqualFold(user.Role, engineerRole) {
+					continue
+				}
+
+				removals = append(removals, policyChange{
+					description: fmt.Sprintf("- %s on %s for %s", have, resourceName(service), user.Login),
+					apply: func(ctx context.Context) error {
+						_, err := services.removeServiceAuthorization(ctx, principal, service)
+						return err
+					},
+				})
+			default:
+				symbol, from := "+", ""
+				if have != "" {
+					symbol, from = "~", fmt.Sprintf(" (from %s)", have)
+				}
+
+				entitlements := permissionEntitlementMap[want]
+				entitlement := ent.NewAssignmentEntitlement(service, entitlements[len(entitlements)-1])
+
+				serviceChanges = append(serviceChanges, policyChange{
+					description: fmt.Sprintf("%s %s on %s for %s%s", symbol, want, resourceName(service), user.Login, from),
+					apply: func(ctx context.Context) error {
+						_, err := services.Grant(ctx, principal, entitlement)
+						return err
+					},
+				})
+			}
+		}
+	}
+
+	for _, user := range state.users {
+		if managed[strings.ToLower(user.Login)] {
+			continue
+		}
+
+		if user.ID == a.userId {
+			plan.notes = append(plan.notes, fmt.Sprintf("%s is not in the policy, but is the user of the access token and left alone", user.Login))
+			continue
+		}
+
+		user := user
+		switch policy.unmanagedAction(user.Login) {
+		case UnmanagedIgnore:
+		case UnmanagedReport:
+			plan.notes = append(plan.notes, fmt.Sprintf("%s is not in the policy (role %s)", user.Login, resourceName(state.userRoles[user.ID])))
+		case UnmanagedDowngrade:
+			current := state.userRoles[user.ID]
+			if current == nil || strings.EqualFold(current.Id.Resource, revokedRole) {
+				continue
+			}
+
+			principal, err := newUserResource(ctx, user, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			roleChanges = append(roleChanges, policyChange{
+				description: fmt.Sprintf("~ role of %s: %s -> %s (not in the policy)", user.Login, resourceName(current), revokedRole),
+				apply: func(ctx context.Context) error {
+					_, err := roles.Revoke(ctx, newPolicyGrant(current, assignedEntitlement, principal))
+					return err
+				},
+			})
+		case UnmanagedLock:
+			if user.Locked {
+				continue
+			}
+
+			roleChanges = append(roleChanges, policyChange{
+				description: fmt.Sprintf("~ lock %s (not in the policy)", user.Login),
+				apply: func(ctx context.Context) error {
+					if d.dryRun {
+						plan := newProvisioningPlan("lock")
+						plan.call(http.MethodPut, fmt.Sprintf("/user/%s", user.ID), "LockUser", map[string]interface{}{"locked": true})
+						plan.log(ctxzap.Extract(ctx))
+
+						return nil
+					}
+
+					return lockUser(a.client, user.ID)
+				},
+			})
+		}
+	}
+
+	plan.changes = append(append(removals, roleChanges...), serviceChanges...)
+
+	return plan, nil
+}
+
+// gatherPolicyState lists the users of the account, and the roles and service permissions they have
+// according to the grants of the role and service builders.
+func gatherPolicyState(ctx context.Context, a *account, roles *roleBuilder, services *serviceBuilder) (*policyState, error) {
+	users, err := a.client.ListCustomerUsers(&fastly.ListCustomerUsersInput{CustomerID: a.customerId})
+	if err != nil {
+		return nil, wrapError(err, "error listing users")
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Login < users[j].Login })
+
+	state := &policyState{
+		users:       users,
+		userRoles:   make(map[string]*v2.Resource),
+		permissions: make(map[string]map[string]string),
+	}
+
+	state.roles, err = listAllResources(ctx, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range state.roles {
+		// Other IAM roles are assigned next to the user's role, which is what the policy manages.
+		if _, ok := legacyRoleName(role.Id.Resource); !ok {
+			continue
+		}
+
+		grants, err := listAllGrants(ctx, roles, role)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range grants {
+			state.userRoles[g.Principal.Id.Resource] = role
+		}
+	}
+
+	state.services, err = listAllResources(ctx, services)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, service := range state.services {
+		grants, err := listAllGrants(ctx, services, service)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions := make(map[string]string)
+		for _, g := range grants {
+			if g.Principal.Id.ResourceType != userResourceType.Id {
+				continue
+			}
+
+			// Grants carry the entitlement ID only, so the slug is what follows the service in it.
+			slug := strings.TrimPrefix(g.Entitlement.Id, ent.NewEntitlementID(service, ""))
+			permission, ok := entitlementPermissionMap[slug]
+			if !ok {
+				continue
+			}
+
+			userId := g.Principal.Id.Resource
+			if len(permissionEntitlementMap[permission]) > len(permissionEntitlementMap[permissions[userId]]) {
+				permissions[userId] = permission
+			}
+		}
+
+		state.permissions[service.Id.Resource] = permissions
+	}
+
+	return state, nil
+}
+
+// newPolicyGrant returns the grant of the entitlement to the principal. Unlike grant.NewGrant, it sets the
+// slug of the entitlement, which Revoke of the builders relies on.
+func newPolicyGrant(resource *v2.Resource, slug string, principal *v2.Resource) *v2.Grant {
+	entitlement := ent.NewAssignmentEntitlement(resource, slug)
+
+	return &v2.Grant{
+		Id:          newGrantId(entitlement, principal),
+		Entitlement: entitlement,
+		Principal:   principal,
+	}
+}
+
+func listAllResources(ctx context.Context, syncer connectorbuilder.ResourceSyncer) ([]*v2.Resource, error) {
+	var rv []*v2.Resource
+
+	token := &pagination.Token{}
+	for {
+		resources, next, _, err := syncer.List(ctx, nil, token)
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, resources...)
+
+		if next == "" {
+			return rv, nil
+		}
+
+		token = &pagination.Token{Token: next}
+	}
+}
+
+func listAllGrants(ctx context.Context, syncer connectorbuilder.ResourceSyncer, resource *v2.Resource) ([]*v2.Grant, error) {
+	var rv []*v2.Grant
+
+	token := &pagination.Token{}
+	for {
+		grants, next, _, err := syncer.Grants(ctx, resource, token)
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, grants...)
+
+		if next == "" {
+			return rv, nil
+		}
+
+		token = &pagination.Token{Token: next}
+	}
+}
+
+// findPolicyResource returns the resource with the ID, or else the only one with the name.
+func findPolicyResource(resources []*v2.Resource, key string) (*v2.Resource, error) {
+	var byName []*v2.Resource
+	for _, resource := range resources {
+		if resource.Id.Resource == key {
+			return resource, nil
+		}
+
+		if strings.EqualFold(resource.DisplayName, key) {
+			byName = append(byName, resource)
+		}
+	}
+
+	switch len(byName) {
+	case 0:
+		return nil, fmt.Errorf("not found")
+	case 1:
+		return byName[0], nil
+	default:
+		return nil, fmt.Errorf("ambiguous, %d have that name, use the ID", len(byName))
+	}
+}
+
+func resourceName(resource *v2.Resource) string {
+	if resource == nil {
+		return "none"
+	}
+
+	if resource.DisplayName == "" || resource.DisplayName == resource.Id.Resource {
+		return resource.Id.Resource
+	}
+
+	return fmt.Sprintf("%s (%s)", resource.DisplayName, resource.Id.Resource)
+}
@@ -0,0 +1,218 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyUnmanagedAction(t *testing.T) {
+	policy := &Policy{
+		Unmanaged: []UnmanagedRule{
+			{Match: "bot-*", Action: UnmanagedIgnore},
+			{Match: "*@contractor.example", Action: UnmanagedLock},
+			{Match: "temp-*", Action: UnmanagedDowngrade},
+			{Match: "temp-*", Action: UnmanagedLock},
+		},
+	}
+
+	tests := []struct {
+		login string
+		want  string
+	}{
+		{login: "bot-ci", want: UnmanagedIgnore},
+		{login: "BOT-CI", want: UnmanagedIgnore},
+		{login: "jane@contractor.example", want: UnmanagedLock},
+		{login: "temp-jane", want: UnmanagedDowngrade},
+		{login: "jane@example.com", want: UnmanagedReport},
+	}
+
+	for _, tt := range tests {
+		if got := policy.unmanagedAction(tt.login); got != tt.want {
+			t.Errorf("unmanagedAction(%q) = %q, want %q", tt.login, got, tt.want)
+		}
+	}
+
+	catchAll := &Policy{Unmanaged: []UnmanagedRule{{Action: UnmanagedDowngrade}}}
+	if got := catchAll.unmanagedAction("jane@example.com"); got != UnmanagedDowngrade {
+		t.Errorf("unmanagedAction with an empty match = %q, want %q", got, UnmanagedDowngrade)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *Policy
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			policy: &Policy{
+				Users:     []PolicyUser{{Login: "alice", Role: "engineer", Services: map[string]string{"svc": "full"}}},
+				Unmanaged: []UnmanagedRule{{Match: "bot-*", Action: UnmanagedIgnore}},
+			},
+		},
+		{
+			name:    "user twice",
+			policy:  &Policy{Users: []PolicyUser{{Login: "alice", Role: "user"}, {Login: "Alice", Role: "user"}}},
+			wantErr: true,
+		},
+		{
+			name:    "IAM role",
+			policy:  &Policy{Users: []PolicyUser{{Login: "alice", Role: "Studio Admin"}}},
+			wantErr: true,
+		},
+		{
+			name:    "service permissions of a superuser",
+			policy:  &Policy{Users: []PolicyUser{{Login: "alice", Role: "superuser", Services: map[string]string{"svc": "full"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown permission",
+			policy:  &Policy{Users: []PolicyUser{{Login: "alice", Role: "engineer", Services: map[string]string{"svc": "admin"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown action",
+			policy:  &Policy{Unmanaged: []UnmanagedRule{{Action: "delete"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newPolicyTestAccount returns an account whose users cover every kind of change of a plan.
+func newPolicyTestAccount(t *testing.T) (*fakeFastly, *Fastly) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.services["svc-b"] = "Beta"
+
+	f.addUser("u-alice", "alice", "engineer")
+	f.addAuthorization("svc-a", "u-alice", "purge_all")
+	f.addAuthorization("svc-b", "u-alice", "read_only")
+
+	f.addUser("u-bob", "bob", "engineer")
+	f.addAuthorization("svc-a", "u-bob", "read_only")
+
+	f.addUser("u-bot", "bot-ci", "engineer")
+	f.addUser("u-contractor", "contractor-1", "engineer")
+	f.addUser("u-locked", "contractor-2", "engineer")
+	f.users["u-locked"].locked = true
+	f.addUser("u-dave", "dave", "engineer")
+	f.addUser("u-me", "me", "superuser")
+	f.addUser("u-temp", "temp-1", "billing")
+
+	a := &account{client: f.client(), customerId: "cust", userId: "u-me"}
+
+	return f, &Fastly{accounts: []*account{a}}
+}
+
+var testPolicy = &Policy{
+	Users: []PolicyUser{
+		{Login: "alice", Role: "engineer", Services: map[string]string{"Alpha": "full"}},
+		{Login: "bob", Role: "superuser"},
+		{Login: "erin", Role: "user"},
+	},
+	Unmanaged: []UnmanagedRule{
+		{Match: "bot-*", Action: UnmanagedIgnore},
+		{Match: "contractor-*", Action: UnmanagedLock},
+		{Match: "temp-*", Action: UnmanagedDowngrade},
+		{Match: "me", Action: UnmanagedDowngrade},
+	},
+}
+
+func TestPlanPolicy(t *testing.T) {
+	_, d := newPolicyTestAccount(t)
+
+	plan, err := d.PlanPolicy(context.Background(), "", testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+	for _, change := range plan.changes {
+		changes = append(changes, change.description)
+	}
+
+	// Service permissions are removed first, while the users are still engineers, then roles change,
+	// and service permissions are granted last, once the users are engineers.
+	wantChanges := []string{
+		"- read_only on Beta (svc-b) for alice",
+		"- read_only on Alpha (svc-a) for bob",
+		"~ role of bob: Engineer -> Superuser",
+		"~ lock contractor-1 (not in the policy)",
+		"~ role of temp-1: Billing -> User (not in the policy)",
+		"~ full on Alpha (svc-a) for alice (from purge_all)",
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %q, want %q", changes, wantChanges)
+	}
+
+	wantNotes := []string{
+		"erin is in the policy but not a user of the account, use create-account",
+		"dave is not in the policy (role Engineer)",
+		"me is not in the policy, but is the user of the access token and left alone",
+	}
+	if !reflect.DeepEqual(plan.notes, wantNotes) {
+		t.Errorf("notes = %q, want %q", plan.notes, wantNotes)
+	}
+}
+
+func TestApplyPolicyPlan(t *testing.T) {
+	f, d := newPolicyTestAccount(t)
+
+	plan, err := d.PlanPolicy(context.Background(), "", testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := plan.Apply(context.Background(), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	wantRoles := map[string]string{
+		"u-alice": "engineer",
+		"u-bob":   "superuser",
+		"u-bot":   "engineer",
+		"u-me":    "superuser",
+		"u-temp":  "user",
+	}
+	for userId, want := range wantRoles {
+		if role := f.user(userId).role; role != want {
+			t.Errorf("role of %s = %q, want %q", userId, role, want)
+		}
+	}
+
+	if !f.user("u-contractor").locked {
+		t.Error("contractor-1 is not locked")
+	}
+
+	wantPermissions := map[[2]string]string{
+		{"svc-a", "u-alice"}: "full",
+		{"svc-b", "u-alice"}: "",
+		{"svc-a", "u-bob"}:   "",
+	}
+	for key, want := range wantPermissions {
+		if permission := f.permission(key[0], key[1]); permission != want {
+			t.Errorf("permission of %s on %s = %q, want %q", key[1], key[0], permission, want)
+		}
+	}
+
+	replan, err := d.PlanPolicy(context.Background(), "", testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replan.Changes() != 0 {
+		t.Errorf("plan after apply has %d changes, want none", replan.Changes())
+	}
+}
@@ -0,0 +1,76 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+const enableProductEntitlementPrefix = "enable-product:"
+
+var knownProducts = []fastly.Product{
+	fastly.ProductBrotliCompression,
+	fastly.ProductDomainInspector,
+	fastly.ProductFanout,
+	fastly.ProductImageOptimizer,
+	fastly.ProductOriginInspector,
+	fastly.ProductWebSockets,
+}
+
+func enableProductEntitlement(product fastly.Product) string {
+	return enableProductEntitlementPrefix + product.String()
+}
+
+// parseEnableProductEntitlement returns the product of an enable-product entitlement slug.
+func parseEnableProductEntitlement(slug string) (fastly.Product, bool) {
+	if !strings.HasPrefix(slug, enableProductEntitlementPrefix) {
+		return fastly.ProductUndefined, false
+	}
+
+	name := strings.TrimPrefix(slug, enableProductEntitlementPrefix)
+	for _, product := range knownProducts {
+		if product.String() == name {
+			return product, true
+		}
+	}
+
+	return fastly.ProductUndefined, false
+}
+
+// isProductNotEnabledError returns true for the error the API uses to report that a product
+// is not enabled on the service. Other errors, like a token missing a scope, are not hidden as
+// a disabled product.
+func isProductNotEnabledError(err error) bool {
+	var httpErr *fastly.HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+
+	return httpErr.StatusCode == http.StatusNotFound
+}
+
+// listEnabledProducts returns the known products that are enabled on the service.
+func listEnabledProducts(client *fastly.Client, serviceId string) ([]fastly.Product, error) {
+	var rv []fastly.Product
+
+	for _, product := range knownProducts {
+		_, err := client.GetProduct(&fastly.ProductEnablementInput{
+			ProductID: product,
+			ServiceID: serviceId,
+		})
+		if err != nil {
+			if isProductNotEnabledError(err) {
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to get product %s: %w", product, err)
+		}
+
+		rv = append(rv, product)
+	}
+
+	return rv, nil
+}
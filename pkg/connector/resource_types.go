@@ -20,6 +20,81 @@ var (
 		Traits:      []v2.ResourceType_Trait{},
 	}
 
+	serviceVersionResourceType = &v2.ResourceType{
+		Id:          "service_version",
+		DisplayName: "Service Version",
+		Description: "A configuration version of a Fastly service",
+		Traits:      []v2.ResourceType_Trait{},
+		Annotations: getSkippEntitlementsAndGrantsAnnotations(),
+	}
+
+	domainResourceType = &v2.ResourceType{
+		Id:          "domain",
+		DisplayName: "Domain",
+		Description: "A hostname served by the active version of a Fastly service",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+		Annotations: getSkippEntitlementsAndGrantsAnnotations(),
+	}
+
+	backendResourceType = &v2.ResourceType{
+		Id:          "backend",
+		DisplayName: "Backend",
+		Description: "An origin server of the active version of a Fastly service",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+		Annotations: getSkippEntitlementsAndGrantsAnnotations(),
+	}
+
+	loggingEndpointResourceType = &v2.ResourceType{
+		Id:          "logging_endpoint",
+		DisplayName: "Logging Endpoint",
+		Description: "A logging endpoint of the active version of a Fastly service",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+		Annotations: getSkippEntitlementsAndGrantsAnnotations(),
+	}
+
+	aclResourceType = &v2.ResourceType{
+		Id:          "acl",
+		DisplayName: "ACL",
+		Description: "An edge access control list of the active version of a Fastly service",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+
+	dictionaryResourceType = &v2.ResourceType{
+		Id:          "dictionary",
+		DisplayName: "Dictionary",
+		Description: "An edge dictionary of the active version of a Fastly service",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+
+	userGroupResourceType = &v2.ResourceType{
+		Id:          "user_group",
+		DisplayName: "User Group",
+		Description: "A Fastly IAM user group",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
+	}
+
+	serviceGroupResourceType = &v2.ResourceType{
+		Id:          "service_group",
+		DisplayName: "Service Group",
+		Description: "A Fastly IAM service group",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
+	}
+
+	invitationResourceType = &v2.ResourceType{
+		Id:          "invitation",
+		DisplayName: "Invitation",
+		Description: "A pending invitation to the Fastly account",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+
+	accountResourceType = &v2.ResourceType{
+		Id:          "account",
+		DisplayName: "Account",
+		Description: "The Fastly account (customer) and its security settings",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+		Annotations: getSkippEntitlementsAndGrantsAnnotations(),
+	}
+
 	roleResourceType = &v2.ResourceType{
 		Id:          "role",
 		DisplayName: "Role",
@@ -27,3 +102,20 @@ var (
 		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_ROLE},
 	}
 )
+
+// allResourceTypes are the resource types the connector can sync, in the order they are synced.
+var allResourceTypes = []*v2.ResourceType{
+	accountResourceType,
+	userResourceType,
+	serviceResourceType,
+	serviceVersionResourceType,
+	domainResourceType,
+	backendResourceType,
+	loggingEndpointResourceType,
+	aclResourceType,
+	dictionaryResourceType,
+	roleResourceType,
+	userGroupResourceType,
+	serviceGroupResourceType,
+	invitationResourceType,
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -33,13 +34,22 @@ type roleBuilder struct {
 	resourceType *v2.ResourceType
 	client       *fastly.Client
 	customerId   string
+	dryRun       bool
+	grants       *timeBoundGrants
+
+	// assignees are the IDs of the users each IAM role is assigned to, by role ID. They are looked up by
+	// the first Grants of a sync that needs them, and dropped when the next sync lists the roles.
+	mtx       sync.Mutex
+	assignees map[string][]string
 }
 
-func newRoleBuilder(client *fastly.Client, customerId string) *roleBuilder {
+func newRoleBuilder(client *fastly.Client, customerId string, dryRun bool, grants *timeBoundGrants) *roleBuilder {
 	return &roleBuilder{
 		resourceType: roleResourceType,
 		client:       client,
 		customerId:   customerId,
+		dryRun:       dryRun,
+		grants:       grants,
 	}
 }
 
@@ -49,7 +59,8 @@ func (r *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 
 func newRoleResource(ctx context.Context, role string) (*v2.Resource, error) {
 	profile := map[string]interface{}{
-		"name": role,
+		"name":   role,
+		"source": "legacy",
 	}
 
 	roleTraitOptions := []rs.RoleTraitOption{
@@ -64,10 +75,154 @@ func newRoleResource(ctx context.Context, role string) (*v2.Resource, error) {
 	return resource, nil
 }
 
+// legacyRoleName returns the hard-coded role matching the name, if there is one.
+func legacyRoleName(name string) (string, bool) {
+	for _, role := range roles {
+		if strings.EqualFold(role, name) {
+			return role, true
+		}
+	}
+
+	return "", false
+}
+
+// newIAMRoleResource creates a role synced from the IAM roles API. Roles that match one of the
+// hard-coded roles keep its ID so that grants referring to them stay stable.
+func newIAMRoleResource(ctx context.Context, role iamRole, permissions []iamPermission) (*v2.Resource, error) {
+	permissionNames := make([]interface{}, 0, len(permissions))
+	for _, permission := range permissions {
+		permissionNames = append(permissionNames, permission.Name)
+	}
+
+	profile := map[string]interface{}{
+		"id":          role.ID,
+		"name":        role.Name,
+		"permissions": permissionNames,
+		"source":      "iam",
+	}
+
+	if role.Description != "" {
+		profile["description"] = role.Description
+	}
+
+	roleTraitOptions := []rs.RoleTraitOption{
+		rs.WithRoleProfile(profile),
+	}
+
+	resourceId := role.ID
+	if legacyRole, ok := legacyRoleName(role.Name); ok {
+		resourceId = legacyRole
+	}
+
+	resource, err := rs.NewRoleResource(role.Name, roleResourceType, resourceId, roleTraitOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// legacyUserRoleValue returns the value of the user's role attribute that assigns one of the hard-coded
+// roles. Other IAM roles are assigned to users through the IAM role assignments instead.
+func legacyUserRoleValue(roleId string) (string, bool) {
+	legacyRole, ok := legacyRoleName(roleId)
+	if !ok {
+		return "", false
+	}
+
+	return strings.ToLower(legacyRole), true
+}
+
+// roleAssignees returns the IDs of the users the IAM role is assigned to. The roles of every user are
+// listed once per sync, since the IAM API only lists role assignments by user.
+func (r *roleBuilder) roleAssignees(roleId string) ([]string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.assignees != nil {
+		return r.assignees[roleId], nil
+	}
+
+	users, err := r.client.ListCustomerUsers(&fastly.ListCustomerUsersInput{CustomerID: r.customerId})
+	if err != nil {
+		return nil, err
+	}
+
+	assignees := make(map[string][]string)
+	for _, user := range users {
+		userRoles, err := listUserRoles(r.client, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, role := range userRoles {
+			assignees[role.ID] = append(assignees[role.ID], user.ID)
+		}
+	}
+
+	r.assignees = assignees
+
+	return assignees[roleId], nil
+}
+
+// List returns the hard-coded roles, which every account has, followed by the other roles of the IAM
+// roles API. Hard-coded roles that match an IAM role are described by it.
 func (r *roleBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	r.mtx.Lock()
+	r.assignees = nil
+	r.mtx.Unlock()
+
+	iamRoles, err := listRoles(r.client)
+	if err != nil && !isNotFoundError(err) {
+		return nil, "", nil, wrapError(err, "error listing roles")
+	}
+
+	if len(iamRoles) == 0 {
+		l.Debug("baton-fastly: IAM roles are not available for this account, using legacy roles")
+	}
+
+	iamLegacyRoles := make(map[string]iamRole)
+	var otherRoles []iamRole
+	for _, role := range iamRoles {
+		if legacyRole, ok := legacyRoleName(role.Name); ok {
+			iamLegacyRoles[legacyRole] = role
+		} else {
+			otherRoles = append(otherRoles, role)
+		}
+	}
+
 	var resources []*v2.Resource
 	for _, role := range roles {
-		resource, err := newRoleResource(ctx, role)
+		var resource *v2.Resource
+		if iamRole, ok := iamLegacyRoles[role]; ok {
+			permissions, err := listRolePermissions(r.client, iamRole.ID)
+			if err != nil {
+				return nil, "", nil, wrapError(err, "error listing role permissions")
+			}
+
+			resource, err = newIAMRoleResource(ctx, iamRole, permissions)
+			if err != nil {
+				return nil, "", nil, err
+			}
+		} else {
+			resource, err = newRoleResource(ctx, role)
+			if err != nil {
+				return nil, "", nil, err
+			}
+		}
+
+		resources = append(resources, resource)
+	}
+
+	for _, role := range otherRoles {
+		permissions, err := listRolePermissions(r.client, role.ID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error listing role permissions")
+		}
+
+		resource, err := newIAMRoleResource(ctx, role, permissions)
 		if err != nil {
 			return nil, "", nil, err
 		}
@@ -91,29 +246,64 @@ func (o *roleBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _
 	return rv, "", nil, nil
 }
 
+// Grants returns the users holding the role. The hard-coded roles are held through the user's role
+// attribute, the other IAM roles through the role assignments of the users.
 func (o *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	users, err := o.client.ListCustomerUsers(&fastly.ListCustomerUsersInput{CustomerID: o.customerId})
 	if err != nil {
 		return nil, "", nil, wrapError(err, "error listing users")
 	}
 
+	elevations, err := o.grants.active()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	legacyRole, isLegacy := legacyUserRoleValue(resource.Id.Resource)
+
+	var assignees []string
+	if !isLegacy {
+		assignees, err = o.roleAssignees(resource.Id.Resource)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error listing role assignments")
+		}
+	}
+
 	var rv []*v2.Grant
 	for _, user := range users {
-		if !strings.EqualFold(resource.DisplayName, user.Role) {
-			continue
+		var key, held string
+		if isLegacy {
+			if !strings.EqualFold(user.Role, legacyRole) {
+				continue
+			}
+
+			key, held = elevationKey(o.customerId, elevationKindRole, user.ID, ""), user.Role
+		} else {
+			if !containsString(assignees, user.ID) {
+				continue
+			}
+
+			key, held = elevationKey(o.customerId, elevationKindIAMRole, user.ID, resource.Id.Resource), resource.Id.Resource
 		}
 
-		userResource, err := newUserResource(ctx, user)
+		userResource, err := newUserResource(ctx, user, nil)
 		if err != nil {
 			return nil, "", nil, wrapError(err, "error creating user resource")
 		}
 
-		rv = append(rv, grant.NewGrant(resource, assignedEntitlement, userResource.Id))
+		var grantOptions []grant.GrantOption
+		if e, ok := elevations[key]; ok && e.Elevated == held {
+			grantOptions = append(grantOptions, grant.WithGrantMetadata(e.metadata()))
+		}
+
+		rv = append(rv, grant.NewGrant(resource, assignedEntitlement, userResource.Id, grantOptions...))
 	}
 
 	return rv, "", nil, nil
 }
 
+// Grant sets the user's role attribute for the hard-coded roles, which replaces the role the user had,
+// and assigns any other IAM role next to the roles the user has.
 func (o *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
@@ -129,7 +319,47 @@ func (o *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitle
 		return nil, err
 	}
 
-	role := strings.ToLower(entitlement.Resource.Id.Resource)
+	role, ok := legacyUserRoleValue(entitlement.Resource.Id.Resource)
+	if !ok {
+		return o.grantIAMRole(ctx, principal, entitlement.Resource.Id.Resource)
+	}
+
+	if o.dryRun {
+		plan, err := planRoleChange(o.client, "grant", principal.Id.Resource, role)
+		if err != nil {
+			return nil, err
+		}
+
+		return plan.result(l)
+	}
+
+	duration, timeBound := o.grants.roleDuration(entitlement.Resource.Id.Resource)
+
+	var previousRole string
+	if timeBound {
+		user, err := o.client.GetUser(&fastly.GetUserInput{ID: principal.Id.Resource})
+		if err != nil {
+			return nil, wrapError(err, "failed to get user")
+		}
+
+		previousRole = user.Role
+	}
+
+	var annos annotations.Annotations
+	if timeBound {
+		var err error
+		annos, err = o.grants.elevate(&elevation{
+			CustomerID:  o.customerId,
+			Kind:        elevationKindRole,
+			UserID:      principal.Id.Resource,
+			Entitlement: entitlement.Resource.Id.Resource,
+			Previous:    previousRole,
+			Elevated:    role,
+		}, duration)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	_, err := o.client.UpdateUser(&fastly.UpdateUserInput{
 		ID:   principal.Id.Resource,
@@ -143,9 +373,82 @@ func (o *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitle
 			zap.String("role_id", entitlement.Resource.Id.Resource),
 			zap.String("user_id", principal.Id.Resource),
 		)
+
+		return nil, err
 	}
 
-	return nil, nil
+	return annos, nil
+}
+
+// validateIAMRole returns an error unless the role is an IAM role of the account, so that roles the
+// connector can not assign are rejected before anything changes.
+func (o *roleBuilder) validateIAMRole(roleId string) error {
+	iamRoles, err := listRoles(o.client)
+	if err != nil && !isNotFoundError(err) {
+		return wrapError(err, "error listing roles")
+	}
+
+	for _, role := range iamRoles {
+		if role.ID == roleId {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("baton-fastly: role %q is neither one of %s nor an IAM role of the account", roleId, strings.Join(roles, ", "))
+}
+
+func (o *roleBuilder) grantIAMRole(ctx context.Context, principal *v2.Resource, roleId string) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if err := o.validateIAMRole(roleId); err != nil {
+		return nil, err
+	}
+
+	assigned, err := userHasRole(o.client, principal.Id.Resource, roleId)
+	if err != nil {
+		return nil, wrapError(err, "failed to list roles of user")
+	}
+
+	if o.dryRun {
+		return planRoleAssignment("grant", principal.Id.Resource, roleId, assigned, true).result(l)
+	}
+
+	var annos annotations.Annotations
+	if duration, timeBound := o.grants.roleDuration(roleId); timeBound {
+		var previous string
+		if assigned {
+			previous = roleId
+		}
+
+		annos, err = o.grants.elevate(&elevation{
+			CustomerID:  o.customerId,
+			Kind:        elevationKindIAMRole,
+			UserID:      principal.Id.Resource,
+			Entitlement: roleId,
+			Previous:    previous,
+			Elevated:    roleId,
+		}, duration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !assigned {
+		err = addUserRole(o.client, principal.Id.Resource, roleId)
+		if err != nil {
+			err = wrapError(err, "failed to grant role to user")
+
+			l.Error(
+				err.Error(),
+				zap.String("role_id", roleId),
+				zap.String("user_id", principal.Id.Resource),
+			)
+
+			return nil, err
+		}
+	}
+
+	return annos, nil
 }
 
 func (o *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
@@ -165,21 +468,64 @@ func (o *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.
 		return nil, err
 	}
 
+	if _, ok := legacyUserRoleValue(grant.Entitlement.Resource.Id.Resource); !ok {
+		return o.revokeIAMRole(ctx, principal, grant.Entitlement.Resource.Id.Resource)
+	}
+
 	role := strings.ToLower(revokedRole)
 
+	if o.dryRun {
+		plan, err := planRoleChange(o.client, "revoke", principal.Id.Resource, role)
+		if err != nil {
+			return nil, err
+		}
+
+		return plan.result(l)
+	}
+
 	_, err := o.client.UpdateUser(&fastly.UpdateUserInput{
 		ID:   principal.Id.Resource,
 		Role: &role,
 	})
 	if err != nil {
-		err = wrapError(err, "failed to grant role to user")
+		err = wrapError(err, "failed to revoke role from user")
 
 		l.Error(
 			err.Error(),
 			zap.String("role_id", revokedRole),
 			zap.String("user_id", principal.Id.Resource),
 		)
+
+		return nil, err
+	}
+
+	return nil, o.grants.forget(o.customerId, elevationKindRole, principal.Id.Resource, "")
+}
+
+func (o *roleBuilder) revokeIAMRole(ctx context.Context, principal *v2.Resource, roleId string) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if o.dryRun {
+		assigned, err := userHasRole(o.client, principal.Id.Resource, roleId)
+		if err != nil {
+			return nil, wrapError(err, "failed to list roles of user")
+		}
+
+		return planRoleAssignment("revoke", principal.Id.Resource, roleId, assigned, false).result(l)
+	}
+
+	err := removeUserRole(o.client, principal.Id.Resource, roleId)
+	if err != nil {
+		err = wrapError(err, "failed to revoke role from user")
+
+		l.Error(
+			err.Error(),
+			zap.String("role_id", roleId),
+			zap.String("user_id", principal.Id.Resource),
+		)
+
+		return nil, err
 	}
 
-	return nil, nil
+	return nil, o.grants.forget(o.customerId, elevationKindIAMRole, principal.Id.Resource, roleId)
 }
@@ -0,0 +1,80 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRoleListKeepsLegacyRoles(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.iamRoles["r-engineer"] = "engineer"
+	f.iamRoles["r-studio"] = "Studio Admin"
+
+	roles := newRoleBuilder(f.client(), "cust", false, nil)
+
+	resources, err := listAllResources(context.Background(), roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, resource := range resources {
+		ids = append(ids, resource.Id.Resource)
+	}
+
+	want := []string{superUserRole, userRole, billingRole, engineerRole, "r-studio"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("roles = %q, want %q", ids, want)
+	}
+}
+
+func TestRoleGrantsOfIAMRoles(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.iamRoles["r-studio"] = "Studio Admin"
+	f.iamRoles["r-tls"] = "TLS Viewer"
+	f.addUser("u-alice", "alice", "engineer")
+	f.addUser("u-bob", "bob", "user")
+	f.addUser("u-carol", "carol", "engineer")
+	f.userRoles["u-alice"] = []string{"r-studio", "r-tls"}
+	f.userRoles["u-carol"] = []string{"r-studio"}
+
+	roles := newRoleBuilder(f.client(), "cust", false, nil)
+
+	resources, err := listAllResources(context.Background(), roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantHolders := map[string][]string{
+		superUserRole: nil,
+		userRole:      {"u-bob"},
+		billingRole:   nil,
+		engineerRole:  {"u-alice", "u-carol"},
+		"r-studio":    {"u-alice", "u-carol"},
+		"r-tls":       {"u-alice"},
+	}
+
+	for _, resource := range resources {
+		grants, err := listAllGrants(context.Background(), roles, resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var holders []string
+		for _, g := range grants {
+			holders = append(holders, g.Principal.Id.Resource)
+		}
+
+		if want := wantHolders[resource.Id.Resource]; !reflect.DeepEqual(holders, want) {
+			t.Errorf("holders of %s = %q, want %q", resource.Id.Resource, holders, want)
+		}
+	}
+
+	for _, userId := range []string{"u-alice", "u-bob", "u-carol"} {
+		if n := f.countRequests(http.MethodGet, "/users/"+userId+"/roles"); n != 1 {
+			t.Errorf("roles of %s were listed %d times, want once", userId, n)
+		}
+	}
+}
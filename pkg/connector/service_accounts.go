@@ -0,0 +1,109 @@
+package connector
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+const loginEventType = "user.login"
+
+type automationToken struct {
+	ID string `json:"id"`
+}
+
+// listAutomationTokenIds returns the IDs of the account's automation tokens. The go-fastly v8
+// client has no support for the endpoint, so it is called directly.
+func listAutomationTokenIds(client *fastly.Client) (map[string]bool, error) {
+	tokens, err := iamList[automationToken](client, "/automation-tokens")
+	if err != nil {
+		if isNotFoundError(err) {
+			return map[string]bool{}, nil
+		}
+
+		return nil, err
+	}
+
+	rv := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		rv[token.ID] = true
+	}
+
+	return rv, nil
+}
+
+// serviceAccountDetector decides which Fastly users are service accounts rather than humans.
+type serviceAccountDetector struct {
+	loginPatterns []string
+}
+
+func newServiceAccountDetector(loginPatterns []string) *serviceAccountDetector {
+	patterns := make([]string, 0, len(loginPatterns))
+	for _, pattern := range loginPatterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" {
+			patterns = append(patterns, strings.ToLower(pattern))
+		}
+	}
+
+	return &serviceAccountDetector{loginPatterns: patterns}
+}
+
+// validateServiceAccountLoginPatterns returns an error for malformed login patterns.
+func validateServiceAccountLoginPatterns(loginPatterns []string) error {
+	for _, pattern := range loginPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid service account login pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *serviceAccountDetector) matchesLogin(login string) bool {
+	login = strings.ToLower(login)
+
+	for _, pattern := range d.loginPatterns {
+		if matched, _ := path.Match(pattern, login); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detect returns the IDs of users that are service accounts: users matching one of the login patterns,
+// and users that only hold automation tokens and did not log in interactively within the activity window.
+func (d *serviceAccountDetector) detect(client *fastly.Client, users []*fastly.User, activity *activityReport) (map[string]bool, error) {
+	rv := make(map[string]bool)
+
+	for _, user := range users {
+		if d.matchesLogin(user.Login) {
+			rv[user.ID] = true
+		}
+	}
+
+	automationTokenIds, err := listAutomationTokenIds(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list automation tokens: %w", err)
+	}
+
+	if len(automationTokenIds) == 0 {
+		return rv, nil
+	}
+
+	for userId, tokens := range activity.tokens {
+		onlyAutomationTokens := len(tokens) > 0
+		for _, token := range tokens {
+			onlyAutomationTokens = onlyAutomationTokens && automationTokenIds[token.ID]
+		}
+
+		if onlyAutomationTokens && !activity.loggedIn(userId) {
+			rv[userId] = true
+		}
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,168 @@
+package connector
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+// Service filter patterns prefixed with this are regular expressions matched against the service name.
+const serviceFilterRegexPrefix = "re:"
+
+// serviceMatcher matches a service by its ID, by a glob of its name or by a regular expression of its name.
+type serviceMatcher struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newServiceMatcher(pattern string) (*serviceMatcher, error) {
+	if expr, ok := strings.CutPrefix(pattern, serviceFilterRegexPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("baton-fastly: invalid service filter %q: %w", pattern, err)
+		}
+
+		return &serviceMatcher{pattern: pattern, re: re}, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("baton-fastly: invalid service filter %q: %w", pattern, err)
+	}
+
+	return &serviceMatcher{pattern: pattern}, nil
+}
+
+func (m *serviceMatcher) matches(id, name string) bool {
+	if m.re != nil {
+		return m.re.MatchString(name)
+	}
+
+	if m.pattern == id {
+		return true
+	}
+
+	matched, _ := path.Match(m.pattern, name)
+	return matched
+}
+
+// serviceFilter decides which services are synced. It is shared by the service builder and the builders
+// of the resources that belong to services, so that they all agree on which services are in scope.
+type serviceFilter struct {
+	include []*serviceMatcher
+	exclude []*serviceMatcher
+	types   map[string]bool
+
+	mu       sync.Mutex
+	services map[string]bool
+}
+
+func newServiceFilter(include, exclude, types []string) (*serviceFilter, error) {
+	rv := &serviceFilter{
+		types:    make(map[string]bool),
+		services: make(map[string]bool),
+	}
+
+	for _, pattern := range include {
+		matcher, err := newServiceMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		rv.include = append(rv.include, matcher)
+	}
+
+	for _, pattern := range exclude {
+		matcher, err := newServiceMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		rv.exclude = append(rv.exclude, matcher)
+	}
+
+	for _, serviceType := range types {
+		if serviceType != vclServiceType && serviceType != computeServiceType {
+			return nil, fmt.Errorf("baton-fastly: invalid service type %q, must be %s or %s", serviceType, vclServiceType, computeServiceType)
+		}
+
+		rv.types[serviceType] = true
+	}
+
+	return rv, nil
+}
+
+func (f *serviceFilter) isEmpty() bool {
+	return f == nil || (len(f.include) == 0 && len(f.exclude) == 0 && len(f.types) == 0)
+}
+
+// matches returns true if the service with the given ID, name and type is in scope.
+func (f *serviceFilter) matches(id, name, serviceType string) bool {
+	if f.isEmpty() {
+		return true
+	}
+
+	if len(f.types) > 0 && !f.types[serviceType] {
+		return false
+	}
+
+	if len(f.include) > 0 {
+		included := false
+		for _, matcher := range f.include {
+			if matcher.matches(id, name) {
+				included = true
+				break
+			}
+		}
+
+		if !included {
+			return false
+		}
+	}
+
+	for _, matcher := range f.exclude {
+		if matcher.matches(id, name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *serviceFilter) matchesService(service *fastly.Service) bool {
+	rv := f.matches(service.ID, service.Name, service.Type)
+
+	if !f.isEmpty() {
+		f.mu.Lock()
+		f.services[service.ID] = rv
+		f.mu.Unlock()
+	}
+
+	return rv
+}
+
+// allowsServiceId returns true if the service with the given ID is in scope, looking the service up
+// if it has not been seen yet.
+func (f *serviceFilter) allowsServiceId(client *fastly.Client, serviceId string) (bool, error) {
+	if f.isEmpty() {
+		return true, nil
+	}
+
+	f.mu.Lock()
+	allowed, ok := f.services[serviceId]
+	f.mu.Unlock()
+
+	if ok {
+		return allowed, nil
+	}
+
+	service, err := client.GetService(&fastly.GetServiceInput{ID: serviceId})
+	if err != nil {
+		return false, err
+	}
+
+	return f.matchesService(service), nil
+}
@@ -0,0 +1,328 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+type serviceGroupBuilder struct {
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+
+	// holders are the user groups and users each service group is assigned to, by service group ID. They
+	// are looked up by the first Grants of a sync, and dropped when the next sync lists the service groups.
+	mtx     sync.Mutex
+	holders map[string]*serviceGroupHolders
+}
+
+type serviceGroupHolders struct {
+	userGroupIds []string
+	userIds      []string
+}
+
+func (o *serviceGroupBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return serviceGroupResourceType
+}
+
+func newServiceGroupResource(ctx context.Context, serviceGroup iamServiceGroup) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"id":   serviceGroup.ID,
+		"name": serviceGroup.Name,
+	}
+
+	if serviceGroup.Description != "" {
+		profile["description"] = serviceGroup.Description
+	}
+
+	groupTraitOptions := []rs.GroupTraitOption{
+		rs.WithGroupProfile(profile),
+	}
+
+	resource, err := rs.NewGroupResource(serviceGroup.Name, serviceGroupResourceType, serviceGroup.ID, groupTraitOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns all IAM service groups. Accounts that have not been migrated to IAM have none.
+func (o *serviceGroupBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	o.mtx.Lock()
+	o.holders = nil
+	o.mtx.Unlock()
+
+	serviceGroups, err := listServiceGroups(o.client)
+	if err != nil {
+		if isNotFoundError(err) {
+			l.Debug("baton-fastly: service groups are not available for this account")
+			return nil, "", nil, nil
+		}
+
+		return nil, "", nil, wrapError(err, "error listing service groups")
+	}
+
+	var resources []*v2.Resource
+	for _, serviceGroup := range serviceGroups {
+		resource, err := newServiceGroupResource(ctx, serviceGroup)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating service group resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *serviceGroupBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+
+	assigmentOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(serviceResourceType),
+		ent.WithDescription(fmt.Sprintf("Service in %s service group", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s service group %s", resource.DisplayName, memberEntitlement)),
+	}
+	rv = append(rv, ent.NewAssignmentEntitlement(resource, memberEntitlement, assigmentOptions...))
+
+	assigmentOptions = []ent.EntitlementOption{
+		ent.WithGrantableTo(userGroupResourceType, userResourceType),
+		ent.WithDescription(fmt.Sprintf("Assigned to %s service group", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s service group %s", resource.DisplayName, assignedEntitlement)),
+	}
+	rv = append(rv, ent.NewAssignmentEntitlement(resource, assignedEntitlement, assigmentOptions...))
+
+	return rv, "", nil, nil
+}
+
+// serviceGroupHolders returns the user groups and users the service group is assigned to. The service
+// groups of every user group and user are listed once per sync, since the IAM API only lists service group
+// assignments by user group and by user. Accounts that have not been migrated to IAM have neither.
+func (o *serviceGroupBuilder) serviceGroupHolders(serviceGroupId string) (*serviceGroupHolders, error) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if o.holders != nil {
+		return o.holderFor(serviceGroupId), nil
+	}
+
+	holders := make(map[string]*serviceGroupHolders)
+	holder := func(id string) *serviceGroupHolders {
+		if _, ok := holders[id]; !ok {
+			holders[id] = &serviceGroupHolders{}
+		}
+
+		return holders[id]
+	}
+
+	userGroups, err := listUserGroups(o.client)
+	if err != nil && !isNotFoundError(err) {
+		return nil, wrapError(err, "error listing user groups")
+	}
+
+	for _, userGroup := range userGroups {
+		serviceGroups, err := listUserGroupServiceGroups(o.client, userGroup.ID)
+		if err != nil && !isNotFoundError(err) {
+			return nil, wrapError(err, "error listing user group service groups")
+		}
+
+		for _, serviceGroup := range serviceGroups {
+			h := holder(serviceGroup.ID)
+			h.userGroupIds = append(h.userGroupIds, userGroup.ID)
+		}
+	}
+
+	users, err := o.client.ListCustomerUsers(&fastly.ListCustomerUsersInput{CustomerID: o.customerId})
+	if err != nil {
+		return nil, wrapError(err, "error listing users")
+	}
+
+	for _, user := range users {
+		serviceGroups, err := listUserServiceGroups(o.client, user.ID)
+		if err != nil {
+			if isNotFoundError(err) {
+				continue
+			}
+
+			return nil, wrapError(err, "error listing user service groups")
+		}
+
+		for _, serviceGroup := range serviceGroups {
+			h := holder(serviceGroup.ID)
+			h.userIds = append(h.userIds, user.ID)
+		}
+	}
+
+	o.holders = holders
+
+	return o.holderFor(serviceGroupId), nil
+}
+
+func (o *serviceGroupBuilder) holderFor(serviceGroupId string) *serviceGroupHolders {
+	if h, ok := o.holders[serviceGroupId]; ok {
+		return h
+	}
+
+	return &serviceGroupHolders{}
+}
+
+// Grants returns a member grant for every service in the group and an assigned grant for every
+// user group and user holding the service group. Users of those user groups get it through grant
+// expansion.
+func (o *serviceGroupBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var rv []*v2.Grant
+
+	services, err := listServiceGroupServices(o.client, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error listing service group services")
+	}
+
+	for _, service := range services {
+		if !o.serviceFilter.matches(service.ID, service.Name, service.Type) {
+			continue
+		}
+
+		serviceId, err := rs.NewResourceID(serviceResourceType, service.ID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating service resource id")
+		}
+
+		rv = append(rv, grant.NewGrant(resource, memberEntitlement, serviceId))
+	}
+
+	holders, err := o.serviceGroupHolders(resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for _, id := range holders.userGroupIds {
+		userGroupId, err := rs.NewResourceID(userGroupResourceType, id)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating user group resource id")
+		}
+
+		rv = append(rv, grant.NewGrant(
+			resource,
+			assignedEntitlement,
+			userGroupId,
+			grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{ent.NewEntitlementID(&v2.Resource{Id: userGroupId}, memberEntitlement)},
+			}),
+		))
+	}
+
+	for _, id := range holders.userIds {
+		userId, err := rs.NewResourceID(userResourceType, id)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating user resource id")
+		}
+
+		rv = append(rv, grant.NewGrant(resource, assignedEntitlement, userId))
+	}
+
+	return rv, "", nil, nil
+}
+
+func (o *serviceGroupBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	err := o.validateGrantOperation(principal, entitlement, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if principal.Id.ResourceType == userResourceType.Id {
+		err = addUserServiceGroup(o.client, principal.Id.Resource, entitlement.Resource.Id.Resource)
+	} else {
+		err = addUserGroupServiceGroup(o.client, principal.Id.Resource, entitlement.Resource.Id.Resource)
+	}
+	if err != nil {
+		err = wrapError(err, "failed to assign service group")
+
+		l.Error(
+			err.Error(),
+			zap.String("service_group_id", entitlement.Resource.Id.Resource),
+			zap.String("principal_id", principal.Id.Resource),
+			zap.String("principal_type", principal.Id.ResourceType),
+		)
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (o *serviceGroupBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	principal := grant.Principal
+	entitlement := grant.Entitlement
+
+	err := o.validateGrantOperation(principal, entitlement, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if principal.Id.ResourceType == userResourceType.Id {
+		err = removeUserServiceGroup(o.client, principal.Id.Resource, entitlement.Resource.Id.Resource)
+	} else {
+		err = removeUserGroupServiceGroup(o.client, principal.Id.Resource, entitlement.Resource.Id.Resource)
+	}
+	if err != nil {
+		err = wrapError(err, "failed to unassign service group")
+
+		l.Error(
+			err.Error(),
+			zap.String("service_group_id", entitlement.Resource.Id.Resource),
+			zap.String("principal_id", principal.Id.Resource),
+			zap.String("principal_type", principal.Id.ResourceType),
+		)
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// Only the assignment of service groups to user groups and users can be provisioned.
+func (o *serviceGroupBuilder) validateGrantOperation(principal *v2.Resource, entitlement *v2.Entitlement, l *zap.Logger) error {
+	principalType := principal.Id.ResourceType
+	if entitlement.Slug != assignedEntitlement || (principalType != userGroupResourceType.Id && principalType != userResourceType.Id) {
+		err := fmt.Errorf("baton-fastly: only user groups and users can be granted to or revoked from service groups")
+
+		l.Warn(
+			err.Error(),
+			zap.String("entitlement_id", entitlement.Id),
+			zap.String("principal_id", principal.Id.Resource),
+			zap.String("principal_type", principal.Id.ResourceType),
+		)
+
+		return err
+	}
+
+	return nil
+}
+
+func newServiceGroupBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter) *serviceGroupBuilder {
+	return &serviceGroupBuilder{
+		resourceType:  serviceGroupResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+	}
+}
@@ -0,0 +1,130 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+)
+
+// serviceGroupGrants returns the principals of the grants of every service group, as "<type>:<id>", by
+// service group ID.
+func serviceGroupGrants(t *testing.T, serviceGroups *serviceGroupBuilder) map[string][]string {
+	resources, err := listAllResources(context.Background(), serviceGroups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv := make(map[string][]string)
+	for _, resource := range resources {
+		grants, err := listAllGrants(context.Background(), serviceGroups, resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, g := range grants {
+			rv[resource.Id.Resource] = append(rv[resource.Id.Resource], g.Principal.Id.ResourceType+":"+g.Principal.Id.Resource)
+		}
+	}
+
+	return rv
+}
+
+func TestServiceGroupGrants(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.serviceGroups["sg-1"] = "Production"
+	f.serviceGroups["sg-2"] = "Staging"
+	f.serviceGroupServices["sg-1"] = []string{"svc-a"}
+	f.userGroups["ug-1"] = "Engineers"
+	f.userGroupServiceGroups["ug-1"] = []string{"sg-1", "sg-2"}
+	f.addUser("u-alice", "alice", "engineer")
+	f.addUser("u-bob", "bob", "engineer")
+	f.userServiceGroups["u-alice"] = []string{"sg-1"}
+
+	serviceGroups := newServiceGroupBuilder(f.client(), "cust", nil)
+
+	want := map[string][]string{
+		"sg-1": {"service:svc-a", "user_group:ug-1", "user:u-alice"},
+		"sg-2": {"user_group:ug-1"},
+	}
+	if got := serviceGroupGrants(t, serviceGroups); !reflect.DeepEqual(got, want) {
+		t.Errorf("grants = %q, want %q", got, want)
+	}
+
+	if n := f.countRequests(http.MethodGet, "/user-groups/ug-1/service-groups"); n != 1 {
+		t.Errorf("service groups of the user group were listed %d times, want once", n)
+	}
+
+	// The next sync looks the holders up again.
+	f.userServiceGroups["u-bob"] = []string{"sg-2"}
+
+	want["sg-2"] = append(want["sg-2"], "user:u-bob")
+	if got := serviceGroupGrants(t, serviceGroups); !reflect.DeepEqual(got, want) {
+		t.Errorf("grants of the next sync = %q, want %q", got, want)
+	}
+}
+
+func TestServiceGroupGrantsWithoutUserGroups(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.serviceGroups["sg-1"] = "Production"
+	f.addUser("u-alice", "alice", "engineer")
+	f.userServiceGroups["u-alice"] = []string{"sg-1"}
+	f.failures[http.MethodGet+" /user-groups"] = http.StatusNotFound
+
+	want := map[string][]string{"sg-1": {"user:u-alice"}}
+	if got := serviceGroupGrants(t, newServiceGroupBuilder(f.client(), "cust", nil)); !reflect.DeepEqual(got, want) {
+		t.Errorf("grants = %q, want %q", got, want)
+	}
+}
+
+func TestServiceGroupGrantAndRevoke(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	serviceGroups := newServiceGroupBuilder(f.client(), "cust", nil)
+
+	serviceGroup := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceGroupResourceType.Id, Resource: "sg-1"}}
+	entitlement := ent.NewAssignmentEntitlement(serviceGroup, assignedEntitlement)
+
+	principals := []struct {
+		principal   *v2.Resource
+		assignments map[string][]string
+	}{
+		{
+			principal:   &v2.Resource{Id: &v2.ResourceId{ResourceType: userGroupResourceType.Id, Resource: "ug-1"}},
+			assignments: f.userGroupServiceGroups,
+		},
+		{
+			principal:   &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "u-alice"}},
+			assignments: f.userServiceGroups,
+		},
+	}
+
+	for _, p := range principals {
+		id := p.principal.Id.Resource
+
+		if _, err := serviceGroups.Grant(context.Background(), p.principal, entitlement); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := p.assignments[id]; !reflect.DeepEqual(got, []string{"sg-1"}) {
+			t.Errorf("service groups of %s after Grant = %q, want [sg-1]", id, got)
+		}
+
+		g := newPolicyGrant(serviceGroup, assignedEntitlement, p.principal)
+		if _, err := serviceGroups.Revoke(context.Background(), g); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := p.assignments[id]; len(got) != 0 {
+			t.Errorf("service groups of %s after Revoke = %q, want none", id, got)
+		}
+	}
+
+	service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc-a"}}
+	if _, err := serviceGroups.Grant(context.Background(), service, ent.NewAssignmentEntitlement(serviceGroup, memberEntitlement)); err == nil {
+		t.Error("Grant of the member entitlement succeeded, want error")
+	}
+}
@@ -0,0 +1,110 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+type serviceVersionBuilder struct {
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+}
+
+func (o *serviceVersionBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return serviceVersionResourceType
+}
+
+func versionStatus(version *fastly.Version) string {
+	switch {
+	case version.Active:
+		return "active"
+	case version.Staging:
+		return "staging"
+	case version.Locked:
+		return "locked"
+	default:
+		return "draft"
+	}
+}
+
+func newServiceVersionResource(ctx context.Context, version *fastly.Version, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	resourceOptions := []rs.ResourceOption{
+		rs.WithParentResourceID(parentResourceID),
+	}
+
+	if version.Comment != "" {
+		resourceOptions = append(resourceOptions, rs.WithDescription(version.Comment))
+	}
+
+	resource, err := rs.NewResource(
+		fmt.Sprintf("Version %d (%s)", version.Number, versionStatus(version)),
+		serviceVersionResourceType,
+		fmt.Sprintf("%s:%d", version.ServiceID, version.Number),
+		resourceOptions...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns all versions of the parent service.
+func (o *serviceVersionBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	allowed, err := o.serviceFilter.allowsServiceId(o.client, parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error filtering service")
+	}
+
+	if !allowed {
+		return nil, "", nil, nil
+	}
+
+	versions, err := o.client.ListVersions(&fastly.ListVersionsInput{ServiceID: parentResourceID.Resource})
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error listing service versions")
+	}
+
+	var resources []*v2.Resource
+	for _, version := range versions {
+		resource, err := newServiceVersionResource(ctx, version, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating service version resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+// Entitlements always returns an empty slice for service versions.
+func (o *serviceVersionBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants always returns an empty slice for service versions since they don't have any entitlements.
+func (o *serviceVersionBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func newServiceVersionBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter) *serviceVersionBuilder {
+	return &serviceVersionBuilder{
+		resourceType:  serviceVersionResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+	}
+}
@@ -17,9 +17,13 @@ import (
 )
 
 type serviceBuilder struct {
-	resourceType *v2.ResourceType
-	client       *fastly.Client
-	customerId   string
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+	dryRun        bool
+	grants        *timeBoundGrants
+	cache         *syncCache
 }
 
 const (
@@ -29,6 +33,11 @@ const (
 	FullAccessPermission  = "full"
 )
 
+const (
+	vclServiceType     = "vcl"
+	computeServiceType = "wasm"
+)
+
 var (
 	permissionEntitlementMap = map[string][]string{
 		ReadOnlyPermission:    {readStatsAndConfigurationEntitlement},
@@ -49,11 +58,15 @@ var (
 	}
 )
 
-func newServiceBuilder(client *fastly.Client, customerId string) *serviceBuilder {
+func newServiceBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter, dryRun bool, grants *timeBoundGrants, cache *syncCache) *serviceBuilder {
 	return &serviceBuilder{
-		resourceType: serviceResourceType,
-		client:       client,
-		customerId:   customerId,
+		resourceType:  serviceResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+		dryRun:        dryRun,
+		grants:        grants,
+		cache:         cache,
 	}
 }
 
@@ -61,12 +74,100 @@ func (o *serviceBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return serviceResourceType
 }
 
+func newServiceResource(ctx context.Context, service *fastly.Service) (*v2.Resource, error) {
+	resource, err := rs.NewResource(
+		service.Name,
+		serviceResourceType,
+		service.ID,
+		rs.WithAnnotation(
+			&v2.ChildResourceType{ResourceTypeId: serviceVersionResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: domainResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: backendResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: loggingEndpointResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: aclResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: dictionaryResourceType.Id},
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// getActiveServiceVersion returns the number of the active version of the service,
+// or 0 if the service has never been activated.
+func getActiveServiceVersion(client *fastly.Client, serviceId string) (int, error) {
+	service, err := client.GetService(&fastly.GetServiceInput{ID: serviceId})
+	if err != nil {
+		return 0, err
+	}
+
+	return service.ActiveVersion, nil
+}
+
+// manageEntriesPermissions are the service permissions that allow editing the entries of
+// the service's ACLs and dictionaries.
+var manageEntriesPermissions = []string{PurgeAllPermission, FullAccessPermission}
+
+// grantManageEntries grants the manage-entries entitlement of an ACL or dictionary to the users
+// that can edit its entries: superusers and the users holding one of the manageEntriesPermissions
+// on the parent service.
+func grantManageEntries(cache *syncCache, resource *v2.Resource) ([]*v2.Grant, error) {
+	if resource.ParentResourceId == nil {
+		return nil, nil
+	}
+
+	users, err := cache.listUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	authorizations, err := cache.serviceAuthorizations(resource.ParentResourceId.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIds []string
+	for _, user := range users {
+		if strings.EqualFold(user.Role, superUserRole) {
+			userIds = append(userIds, user.ID)
+		}
+	}
+
+	for _, authorization := range authorizations {
+		if authorization.User == nil || !containsString(manageEntriesPermissions, authorization.Permission) {
+			continue
+		}
+
+		if !containsString(userIds, authorization.User.ID) {
+			userIds = append(userIds, authorization.User.ID)
+		}
+	}
+
+	var rv []*v2.Grant
+	for _, id := range userIds {
+		userId, err := rs.NewResourceID(userResourceType, id)
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, grant.NewGrant(resource, manageEntriesEntitlement, userId))
+	}
+
+	return rv, nil
+}
+
 func (o *serviceBuilder) List(ctx context.Context, _ *v2.ResourceId, pagination *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
 	bag, page, err := parsePageToken(pagination.Token, &v2.ResourceId{ResourceType: o.resourceType.Id})
 	if err != nil {
 		return nil, "", nil, err
 	}
 
+	if pagination.Token == "" {
+		o.cache.reset()
+	}
+
 	services, err := o.client.ListServices(&fastly.ListServicesInput{Page: page, PerPage: resourcePageSize})
 	if err != nil {
 		return nil, "", nil, err
@@ -74,7 +175,14 @@ func (o *serviceBuilder) List(ctx context.Context, _ *v2.ResourceId, pagination
 
 	var resources []*v2.Resource
 	for _, service := range services {
-		resource, err := rs.NewResource(service.Name, serviceResourceType, service.ID)
+		if !o.serviceFilter.matchesService(service) {
+			continue
+		}
+
+		// The children of the service are listed from its active version.
+		o.cache.setActiveVersion(service.ID, service.ActiveVersion)
+
+		resource, err := newServiceResource(ctx, service)
 		if err != nil {
 			return nil, "", nil, err
 		}
@@ -153,6 +261,15 @@ func (o *serviceBuilder) Entitlements(ctx context.Context, resource *v2.Resource
 	}
 	rv = append(rv, ent.NewAssignmentEntitlement(resource, accessEntitlement, assigmentOptions...))
 
+	for _, product := range knownProducts {
+		assigmentOptions = []ent.EntitlementOption{
+			ent.WithGrantableTo(serviceResourceType),
+			ent.WithDescription(fmt.Sprintf("%s product enabled on %s", product, resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s of %s", enableProductEntitlement(product), resource.DisplayName)),
+		}
+		rv = append(rv, ent.NewAssignmentEntitlement(resource, enableProductEntitlement(product), assigmentOptions...))
+	}
+
 	return rv, "", nil, nil
 }
 
@@ -178,6 +295,13 @@ func (o *serviceBuilder) Grants(ctx context.Context, resource *v2.Resource, pagi
 		}
 
 		rv = append(rv, grants...)
+
+		grants, err = o.grantProducts(ctx, resource)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "failed to grant products")
+		}
+
+		rv = append(rv, grants...)
 	}
 
 	authorizations, err := o.client.ListServiceAuthorizations(&fastly.ListServiceAuthorizationsInput{PageNumber: page, PageSize: resourcePageSize})
@@ -185,7 +309,12 @@ func (o *serviceBuilder) Grants(ctx context.Context, resource *v2.Resource, pagi
 		return nil, "", nil, wrapError(err, "failed to list service authorizations")
 	}
 
-	grants, err := o.grantEngineer(ctx, resource, authorizations.Items)
+	elevations, err := o.grants.active()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	grants, err := o.grantEngineer(ctx, resource, authorizations.Items, elevations)
 	if err != nil {
 		return nil, "", nil, wrapError(err, "failed to process service authorizations")
 	}
@@ -227,7 +356,7 @@ func (o *serviceBuilder) grantUsers(ctx context.Context, service *v2.Resource) (
 	}
 
 	for _, user := range users {
-		userResource, err := newUserResource(ctx, user)
+		userResource, err := newUserResource(ctx, user, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -242,13 +371,29 @@ func (o *serviceBuilder) grantUsers(ctx context.Context, service *v2.Resource) (
 		case strings.ToLower(engineerRole):
 
 		default:
-			return nil, fmt.Errorf("unknown role %s", user.Role)
+			// Other IAM roles only reach services through service authorizations or service groups.
 		}
 	}
 
 	return rv, nil
 }
 
+// Enabled products are modeled as grants of the enable-product entitlements to the service itself.
+// They are only looked up here, so that listing services does not fetch every product of every service.
+func (o *serviceBuilder) grantProducts(ctx context.Context, service *v2.Resource) ([]*v2.Grant, error) {
+	enabledProducts, err := listEnabledProducts(o.client, service.Id.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*v2.Grant
+	for _, product := range enabledProducts {
+		rv = append(rv, grant.NewGrant(service, enableProductEntitlement(product), service.Id))
+	}
+
+	return rv, nil
+}
+
 func grantSuperuser(service *v2.Resource, user *v2.Resource) []*v2.Grant {
 	rv := []*v2.Grant{
 		grant.NewGrant(service, readStatsAndAnalyticsEntitlement, user.Id),
@@ -276,7 +421,8 @@ func grantBilling(service *v2.Resource, user *v2.Resource) []*v2.Grant {
 	return rv
 }
 
-func (o *serviceBuilder) grantEngineer(ctx context.Context, service *v2.Resource, authorizations []*fastly.ServiceAuthorization) ([]*v2.Grant, error) {
+// Entitlements that a time-bound grant added to the service authorization carry its expiry as grant metadata.
+func (o *serviceBuilder) grantEngineer(ctx context.Context, service *v2.Resource, authorizations []*fastly.ServiceAuthorization, elevations map[string]*elevation) ([]*v2.Grant, error) {
 	var rv []*v2.Grant
 
 	for _, authorization := range authorizations {
@@ -286,14 +432,22 @@ func (o *serviceBuilder) grantEngineer(ctx context.Context, service *v2.Resource
 				return nil, err
 			}
 
-			userResource, err := newUserResource(ctx, user)
+			userResource, err := newUserResource(ctx, user, nil)
 			if err != nil {
 				return nil, err
 			}
 
+			e, elevated := elevations[elevationKey(o.customerId, elevationKindService, user.ID, service.Id.Resource)]
+			elevated = elevated && e.Elevated == authorization.Permission
+
 			if entitlements, exists := permissionEntitlementMap[authorization.Permission]; exists {
 				for _, entitlement := range entitlements {
-					rv = append(rv, grant.NewGrant(service, entitlement, userResource.Id))
+					var grantOptions []grant.GrantOption
+					if elevated && !containsString(permissionEntitlementMap[e.Previous], entitlement) {
+						grantOptions = append(grantOptions, grant.WithGrantMetadata(e.metadata()))
+					}
+
+					rv = append(rv, grant.NewGrant(service, entitlement, userResource.Id, grantOptions...))
 				}
 			} else {
 				return nil, fmt.Errorf("unknown permission %s", authorization.Permission)
@@ -307,6 +461,15 @@ func (o *serviceBuilder) grantEngineer(ctx context.Context, service *v2.Resource
 func (o *serviceBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
+	err := o.validateServiceInScope(entitlement.Resource.Id.Resource, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if product, ok := parseEnableProductEntitlement(entitlement.Slug); ok {
+		return o.setProductEnabled(principal, entitlement, product, true, l)
+	}
+
 	permission, exists := entitlementPermissionMap[entitlement.Slug]
 	if !exists {
 		err := fmt.Errorf("baton-fastly: unable to grant %s entitlement", entitlement.Slug)
@@ -319,24 +482,63 @@ func (o *serviceBuilder) Grant(ctx context.Context, principal *v2.Resource, enti
 		return nil, err
 	}
 
-	err := o.validateGrantOperation(principal, entitlement, l)
+	err = o.validateGrantOperation(principal, entitlement, l)
 	if err != nil {
 		return nil, err
 	}
 
+	if o.dryRun {
+		return o.planServiceAuthorization("grant", entitlement.Resource.Id.Resource, principal.Id.Resource, permission, l)
+	}
+
+	duration, timeBound := o.grants.serviceDuration(entitlement.Slug)
+
+	var previousPermission string
+	if timeBound {
+		current, err := o.getServiceAuthorizationForUser(entitlement.Resource.Id.Resource, principal.Id.Resource)
+		if err != nil {
+			return nil, wrapError(err, "failed to get service authorization")
+		}
+
+		if current != nil {
+			previousPermission = current.Permission
+		}
+	}
+
+	var annos annotations.Annotations
+	if timeBound {
+		annos, err = o.grants.elevate(&elevation{
+			CustomerID:  o.customerId,
+			Kind:        elevationKindService,
+			UserID:      principal.Id.Resource,
+			ServiceID:   entitlement.Resource.Id.Resource,
+			Entitlement: entitlement.Slug,
+			Previous:    previousPermission,
+			Elevated:    permission,
+		}, duration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	_, err = o.upsertServiceAuthorizationForUser(entitlement.Resource.Id.Resource, principal.Id.Resource, permission, l)
 	if err != nil {
 		return nil, err
 	}
 
-	return nil, nil
+	return annos, nil
 }
 
 func (o *serviceBuilder) getServiceAuthorizationForUser(serviceId, userId string) (*fastly.ServiceAuthorization, error) {
+	return findServiceAuthorization(o.client, serviceId, userId)
+}
+
+// findServiceAuthorization returns the service authorization of the user on the service, if there is one.
+func findServiceAuthorization(client *fastly.Client, serviceId, userId string) (*fastly.ServiceAuthorization, error) {
 	pageNumber := 1
 
 	for {
-		serviceAuthorizations, err := o.client.ListServiceAuthorizations(&fastly.ListServiceAuthorizationsInput{
+		serviceAuthorizations, err := client.ListServiceAuthorizations(&fastly.ListServiceAuthorizationsInput{
 			PageNumber: pageNumber,
 			PageSize:   resourcePageSize,
 		})
@@ -353,11 +555,23 @@ func (o *serviceBuilder) getServiceAuthorizationForUser(serviceId, userId string
 		if pageNumber >= serviceAuthorizations.Info.Meta.TotalPages {
 			break
 		}
+
+		pageNumber++
 	}
 
 	return nil, nil
 }
 
+// planServiceAuthorization returns the plan of a dry-run Grant or Revoke of a service permission.
+func (o *serviceBuilder) planServiceAuthorization(action, serviceId, userId, permission string, l *zap.Logger) (annotations.Annotations, error) {
+	current, err := o.getServiceAuthorizationForUser(serviceId, userId)
+	if err != nil {
+		return nil, wrapError(err, "failed to get service authorization")
+	}
+
+	return planServiceAuthorization(action, current, serviceId, userId, permission).result(l)
+}
+
 // Service authorization for user can already exist with different permission.
 // In this case we need to update it.
 func (o *serviceBuilder) upsertServiceAuthorizationForUser(serviceId, userId, permission string, l *zap.Logger) (*fastly.ServiceAuthorization, error) {
@@ -384,6 +598,8 @@ func (o *serviceBuilder) upsertServiceAuthorizationForUser(serviceId, userId, pe
 				zap.String("user_id", userId),
 				zap.String("service_id", serviceId),
 			)
+
+			return nil, err
 		}
 
 		return serviceAuthorization, nil
@@ -406,12 +622,133 @@ func (o *serviceBuilder) upsertServiceAuthorizationForUser(serviceId, userId, pe
 				zap.String("user_id", userId),
 				zap.String("service_id", serviceId),
 			)
+
+			return nil, err
 		}
 
 		return serviceAuthorization, nil
 	}
 }
 
+// removeServiceAuthorization removes all access of the user to the service. Revoke can not take away the
+// lowest service permission, so only applying a policy removes service authorizations.
+func (o *serviceBuilder) removeServiceAuthorization(ctx context.Context, principal *v2.Resource, service *v2.Resource) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	serviceId := service.Id.Resource
+
+	err := o.validateServiceInScope(serviceId, l)
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.validateGrantOperation(principal, ent.NewAssignmentEntitlement(service, readStatsAndConfigurationEntitlement), l)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.dryRun {
+		return o.planServiceAuthorization("revoke", serviceId, principal.Id.Resource, "", l)
+	}
+
+	serviceAuthorization, err := o.getServiceAuthorizationForUser(serviceId, principal.Id.Resource)
+	if err != nil {
+		return nil, wrapError(err, "failed to get service authorization")
+	}
+
+	if serviceAuthorization != nil {
+		err = o.client.DeleteServiceAuthorization(&fastly.DeleteServiceAuthorizationInput{ID: serviceAuthorization.ID})
+		if err != nil {
+			err = wrapError(err, "failed to remove service authorization of user")
+
+			l.Error(
+				err.Error(),
+				zap.String("user_id", principal.Id.Resource),
+				zap.String("service_id", serviceId),
+			)
+
+			return nil, err
+		}
+	}
+
+	return nil, o.grants.forget(o.customerId, elevationKindService, principal.Id.Resource, serviceId)
+}
+
+// setProductEnabled enables or disables the product on the service of the entitlement.
+// Only the service itself can be the principal of an enable-product grant.
+func (o *serviceBuilder) setProductEnabled(principal *v2.Resource, entitlement *v2.Entitlement, product fastly.Product, enabled bool, l *zap.Logger) (annotations.Annotations, error) {
+	serviceId := entitlement.Resource.Id.Resource
+
+	if principal.Id.ResourceType != serviceResourceType.Id || principal.Id.Resource != serviceId {
+		err := fmt.Errorf("baton-fastly: products can only be granted to the service they belong to")
+
+		l.Warn(
+			err.Error(),
+			zap.String("principal_id", principal.Id.Resource),
+			zap.String("principal_type", principal.Id.ResourceType),
+			zap.String("service_id", serviceId),
+		)
+
+		return nil, err
+	}
+
+	if o.dryRun {
+		action := "revoke"
+		if enabled {
+			action = "grant"
+		}
+
+		return planProductEnablement(action, product, serviceId, enabled).result(l)
+	}
+
+	input := &fastly.ProductEnablementInput{
+		ProductID: product,
+		ServiceID: serviceId,
+	}
+
+	var err error
+	if enabled {
+		_, err = o.client.EnableProduct(input)
+	} else {
+		err = o.client.DisableProduct(input)
+	}
+	if err != nil {
+		err = wrapError(err, "failed to change product enablement")
+
+		l.Error(
+			err.Error(),
+			zap.String("product", product.String()),
+			zap.Bool("enabled", enabled),
+			zap.String("service_id", serviceId),
+		)
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// Services excluded by the service filter are out of scope for provisioning as well.
+func (o *serviceBuilder) validateServiceInScope(serviceId string, l *zap.Logger) error {
+	allowed, err := o.serviceFilter.allowsServiceId(o.client, serviceId)
+	if err != nil {
+		return wrapError(err, "failed to filter service")
+	}
+
+	if !allowed {
+		err := fmt.Errorf("baton-fastly: service is excluded by the service filter")
+
+		l.Warn(
+			err.Error(),
+			zap.String("service_id", serviceId),
+		)
+
+		return err
+	}
+
+	return nil
+}
+
 func (o *serviceBuilder) validateGrantOperation(principal *v2.Resource, entitlement *v2.Entitlement, l *zap.Logger) error {
 	if principal.Id.ResourceType != userResourceType.Id {
 		err := fmt.Errorf("baton-fastly: only users can be granted to service")
@@ -458,6 +795,15 @@ func (o *serviceBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotatio
 	principal := grant.Principal
 	entitlement := grant.Entitlement
 
+	err := o.validateServiceInScope(entitlement.Resource.Id.Resource, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if product, ok := parseEnableProductEntitlement(entitlement.Slug); ok {
+		return o.setProductEnabled(principal, entitlement, product, false, l)
+	}
+
 	revokedEntitlement, exists := revokeEntitlementMap[entitlement.Slug]
 	if !exists {
 		err := fmt.Errorf("baton-fastly: unable to revoke %s entitlement", entitlement.Slug)
@@ -482,15 +828,19 @@ func (o *serviceBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotatio
 		return nil, err
 	}
 
-	err := o.validateGrantOperation(principal, entitlement, l)
+	err = o.validateGrantOperation(principal, entitlement, l)
 	if err != nil {
 		return nil, err
 	}
 
+	if o.dryRun {
+		return o.planServiceAuthorization("revoke", entitlement.Resource.Id.Resource, principal.Id.Resource, revokedPermission, l)
+	}
+
 	_, err = o.upsertServiceAuthorizationForUser(entitlement.Resource.Id.Resource, principal.Id.Resource, revokedPermission, l)
 	if err != nil {
 		return nil, err
 	}
 
-	return nil, nil
+	return nil, o.grants.forget(o.customerId, elevationKindService, principal.Id.Resource, entitlement.Resource.Id.Resource)
 }
@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+func TestServiceProductGrants(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.services["svc-b"] = "Beta"
+	f.products["svc-a"] = []string{fastly.ProductImageOptimizer.String(), fastly.ProductWebSockets.String()}
+
+	client := f.client()
+	services := newServiceBuilder(client, "cust", nil, false, nil, newSyncCache(client, "cust"))
+
+	resources, _, _, err := services.List(context.Background(), nil, &pagination.Token{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if productRequests := f.countRequestsUnder(http.MethodGet, "/enabled-products/"); productRequests != 0 {
+		t.Errorf("listing services made %d product requests, want none", productRequests)
+	}
+
+	want := map[string][]string{
+		"svc-a": {enableProductEntitlement(fastly.ProductImageOptimizer), enableProductEntitlement(fastly.ProductWebSockets)},
+		"svc-b": nil,
+	}
+
+	for _, resource := range resources {
+		grants, _, _, err := services.Grants(context.Background(), resource, &pagination.Token{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var products []string
+		for _, g := range grants {
+			slug := strings.TrimPrefix(g.Entitlement.Id, serviceResourceType.Id+":"+resource.Id.Resource+":")
+			if _, ok := parseEnableProductEntitlement(slug); ok {
+				products = append(products, slug)
+			}
+		}
+
+		if !reflect.DeepEqual(products, want[resource.Id.Resource]) {
+			t.Errorf("products of %s = %v, want %v", resource.Id.Resource, products, want[resource.Id.Resource])
+		}
+	}
+}
+
+func TestServiceChildrenUseListedActiveVersion(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.activeVersions["svc-a"] = 3
+	f.domains["svc-a"] = []string{"www.example.com", "api.example.com"}
+
+	client := f.client()
+	cache := newSyncCache(client, "cust")
+	services := newServiceBuilder(client, "cust", nil, false, nil, cache)
+	domains := newDomainBuilder(client, "cust", nil, cache)
+
+	resources, err := listAllResources(context.Background(), services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, resource := range resources {
+		children, _, _, err := domains.List(context.Background(), resource.Id, &pagination.Token{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(children) != 2 {
+			t.Errorf("got %d domains of %s, want 2", len(children), resource.Id.Resource)
+		}
+	}
+
+	if n := f.countRequests(http.MethodGet, "/service/svc-a"); n != 0 {
+		t.Errorf("the service was fetched %d times, want its active version from the listing", n)
+	}
+}
+
+func TestServiceRevokeLowestPermission(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.addUser("u-alice", "alice", "engineer")
+	f.addAuthorization("svc-a", "u-alice", "read_only")
+
+	client := f.client()
+	services := newServiceBuilder(client, "cust", nil, false, nil, newSyncCache(client, "cust"))
+
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "u-alice"}}
+	service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc-a"}}
+
+	if _, err := services.Revoke(context.Background(), newPolicyGrant(service, readStatsAndConfigurationEntitlement, user)); err == nil {
+		t.Error("Revoke of the lowest permission succeeded, want error")
+	}
+
+	if permission := f.permission("svc-a", "u-alice"); permission != "read_only" {
+		t.Errorf("permission after Revoke = %q, want read_only", permission)
+	}
+
+	// Only a policy removes the service authorization.
+	if _, err := services.removeServiceAuthorization(context.Background(), user, service); err != nil {
+		t.Fatal(err)
+	}
+
+	if permission := f.permission("svc-a", "u-alice"); permission != "" {
+		t.Errorf("permission after removal = %q, want none", permission)
+	}
+
+	if n := f.countRequestsUnder(http.MethodDelete, "/service-authorizations/"); n != 1 {
+		t.Errorf("service authorizations were deleted %d times, want once", n)
+	}
+}
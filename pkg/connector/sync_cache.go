@@ -0,0 +1,129 @@
+package connector
+
+import (
+	"sync"
+
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+// syncCache holds what the builders of an account look up for many resources during a sync, so that it is
+// fetched from Fastly once per sync instead of once per resource. Every sync lists the services before their
+// children and before any grants, so listing the first page of services resets it.
+type syncCache struct {
+	client     *fastly.Client
+	customerId string
+
+	mtx            sync.Mutex
+	users          []*fastly.User
+	authorizations map[string][]*fastly.ServiceAuthorization
+	// activeVersions are the numbers of the active versions of the listed services, by service ID.
+	activeVersions map[string]int
+}
+
+func newSyncCache(client *fastly.Client, customerId string) *syncCache {
+	return &syncCache{
+		client:     client,
+		customerId: customerId,
+	}
+}
+
+// reset drops everything cached by the previous sync.
+func (c *syncCache) reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.users = nil
+	c.authorizations = nil
+	c.activeVersions = nil
+}
+
+// setActiveVersion records the number of the active version of a listed service.
+func (c *syncCache) setActiveVersion(serviceId string, version int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.activeVersions == nil {
+		c.activeVersions = make(map[string]int)
+	}
+
+	c.activeVersions[serviceId] = version
+}
+
+// activeVersion returns the number of the active version of the service, or 0 if the service has never been
+// activated. Services that were not listed during the sync are looked up.
+func (c *syncCache) activeVersion(serviceId string) (int, error) {
+	c.mtx.Lock()
+	version, ok := c.activeVersions[serviceId]
+	c.mtx.Unlock()
+
+	if ok {
+		return version, nil
+	}
+
+	version, err := getActiveServiceVersion(c.client, serviceId)
+	if err != nil {
+		return 0, err
+	}
+
+	c.setActiveVersion(serviceId, version)
+
+	return version, nil
+}
+
+// listUsers returns the users of the account.
+func (c *syncCache) listUsers() ([]*fastly.User, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.users != nil {
+		return c.users, nil
+	}
+
+	users, err := c.client.ListCustomerUsers(&fastly.ListCustomerUsersInput{CustomerID: c.customerId})
+	if err != nil {
+		return nil, err
+	}
+
+	c.users = users
+
+	return users, nil
+}
+
+// serviceAuthorizations returns the service authorizations that target the service. All service
+// authorizations of the account are listed once and indexed by service.
+func (c *syncCache) serviceAuthorizations(serviceId string) ([]*fastly.ServiceAuthorization, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.authorizations != nil {
+		return c.authorizations[serviceId], nil
+	}
+
+	authorizations := make(map[string][]*fastly.ServiceAuthorization)
+	for pageNumber := 1; ; pageNumber++ {
+		serviceAuthorizations, err := c.client.ListServiceAuthorizations(&fastly.ListServiceAuthorizationsInput{
+			PageNumber: pageNumber,
+			PageSize:   resourcePageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, serviceAuthorization := range serviceAuthorizations.Items {
+			if serviceAuthorization.Service == nil {
+				continue
+			}
+
+			id := serviceAuthorization.Service.ID
+			authorizations[id] = append(authorizations[id], serviceAuthorization)
+		}
+
+		if pageNumber >= serviceAuthorizations.Info.Meta.TotalPages {
+			break
+		}
+	}
+
+	c.authorizations = authorizations
+
+	return authorizations[serviceId], nil
+}
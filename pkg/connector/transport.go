@@ -0,0 +1,152 @@
+package connector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const userAgent = "baton-fastly"
+
+// transportConfig holds the network settings of the HTTP client used for all Fastly API requests.
+type transportConfig struct {
+	proxyURL       string
+	caBundle       string
+	clientCertFile string
+	clientKeyFile  string
+}
+
+func (c *transportConfig) tlsConfig() (*tls.Config, error) {
+	rv := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.caBundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(c.caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("baton-fastly: failed to read CA bundle: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("baton-fastly: CA bundle %s contains no certificates", c.caBundle)
+		}
+
+		rv.RootCAs = pool
+	}
+
+	if c.clientCertFile != "" || c.clientKeyFile != "" {
+		if c.clientCertFile == "" || c.clientKeyFile == "" {
+			return nil, fmt.Errorf("baton-fastly: a client certificate requires both a certificate and a key file")
+		}
+
+		cert, err := tls.LoadX509KeyPair(c.clientCertFile, c.clientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("baton-fastly: failed to load client certificate: %w", err)
+		}
+
+		rv.Certificates = []tls.Certificate{cert}
+	}
+
+	return rv, nil
+}
+
+// newHTTPClient builds the HTTP client through the baton-sdk so that it logs requests and uses the
+// configured TLS settings. The uhttp transport always takes its proxy from the environment, so with a
+// proxy URL the client gets a transport of its own instead, which only sends the Fastly requests through
+// the proxy and leaves the rest of the process alone.
+func (c *transportConfig) newHTTPClient(ctx context.Context) (*http.Client, error) {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.proxyURL != "" {
+		u, err := url.Parse(c.proxyURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("baton-fastly: invalid proxy URL %q", c.proxyURL)
+		}
+
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		base.Proxy = http.ProxyURL(u)
+		base.TLSClientConfig = tlsConfig
+
+		return &http.Client{
+			Transport: &proxyTransport{base: base, logger: ctxzap.Extract(ctx)},
+		}, nil
+	}
+
+	return uhttp.NewClient(
+		ctx,
+		uhttp.WithTLSClientConfig(tlsConfig),
+		uhttp.WithLogger(true, ctxzap.Extract(ctx)),
+		uhttp.WithUserAgent(userAgent),
+	)
+}
+
+// proxyTransport sets the user agent and logs requests like the uhttp transport does.
+type proxyTransport struct {
+	base   http.RoundTripper
+	logger *zap.Logger
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	fields := []zap.Field{
+		zap.String("http.method", req.Method),
+		zap.String("http.url_details.host", req.URL.Host),
+		zap.String("http.url_details.path", req.URL.Path),
+	}
+
+	t.logger.Debug("Request started", fields...)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+
+	if resp != nil {
+		fields = append(fields, zap.Int("http.status_code", resp.StatusCode))
+	}
+
+	t.logger.Debug("Request complete", fields...)
+
+	return resp, err
+}
+
+// ErrReadOnly is returned for every request that would change something in Fastly while the connector is read-only.
+var ErrReadOnly = errors.New("baton-fastly: connector is read-only")
+
+// readOnlyTransport refuses every request that is not a GET or HEAD request before it is sent.
+type readOnlyTransport struct {
+	base http.RoundTripper
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, fmt.Errorf("%w: refusing %s %s", ErrReadOnly, req.Method, req.URL.Path)
+	}
+
+	return t.base.RoundTrip(req)
+}
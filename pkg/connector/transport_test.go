@@ -0,0 +1,104 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/fastly/go-fastly/v8/fastly"
+)
+
+func TestReadOnly(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.addUser("u-alice", "alice", "engineer")
+	f.addAuthorization("svc-a", "u-alice", "full")
+	f.userRoles["u-alice"] = []string{"r-studio"}
+	f.products["svc-a"] = []string{fastly.ProductWebSockets.String()}
+
+	t.Setenv(fastly.EndpointEnvVar, f.url())
+
+	d, err := New(context.Background(), "token", WithReadOnly(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := d.accounts[0]
+	roles := newRoleBuilder(a.client, a.customerId, false, nil)
+	services := newServiceBuilder(a.client, a.customerId, nil, false, nil, newSyncCache(a.client, a.customerId))
+
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "u-alice"}}
+	superuser := &v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: superUserRole}}
+	studio := &v2.Resource{Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: "r-studio"}}
+	service := &v2.Resource{Id: &v2.ResourceId{ResourceType: serviceResourceType.Id, Resource: "svc-a"}}
+
+	changes := []struct {
+		name   string
+		change func() error
+	}{
+		{
+			name: "role grant",
+			change: func() error {
+				_, err := roles.Grant(context.Background(), user, ent.NewAssignmentEntitlement(superuser, assignedEntitlement))
+				return err
+			},
+		},
+		{
+			name: "service grant",
+			change: func() error {
+				_, err := services.Grant(context.Background(), user, ent.NewAssignmentEntitlement(service, purgeAllEntitlement))
+				return err
+			},
+		},
+		{
+			name: "service revoke",
+			change: func() error {
+				_, err := services.Revoke(context.Background(), newPolicyGrant(service, fullAccessEntitlement, user))
+				return err
+			},
+		},
+		{
+			name: "product enable",
+			change: func() error {
+				product := enableProductEntitlement(fastly.ProductImageOptimizer)
+				_, err := services.Grant(context.Background(), service, ent.NewAssignmentEntitlement(service, product))
+				return err
+			},
+		},
+		{
+			name: "delete",
+			change: func() error {
+				_, err := roles.Revoke(context.Background(), newPolicyGrant(studio, assignedEntitlement, user))
+				return err
+			},
+		},
+	}
+
+	for _, tt := range changes {
+		if err := tt.change(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s = %v, want %v", tt.name, err, ErrReadOnly)
+		}
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if n := f.countRequestsUnder(method, "/"); n != 0 {
+			t.Errorf("the server received %d %s requests, want none", n, method)
+		}
+	}
+
+	if role := f.user("u-alice").role; role != "engineer" {
+		t.Errorf("role = %q, want engineer", role)
+	}
+
+	resources, err := listAllResources(context.Background(), services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 1 {
+		t.Errorf("got %d services, want 1", len(resources))
+	}
+}
@@ -0,0 +1,248 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/fastly/go-fastly/v8/fastly"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+type userGroupBuilder struct {
+	resourceType  *v2.ResourceType
+	client        *fastly.Client
+	customerId    string
+	serviceFilter *serviceFilter
+}
+
+func (o *userGroupBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return userGroupResourceType
+}
+
+// newUserGroupResource creates a user group whose profile shows the roles and service groups assigned to it,
+// and the services it confers through those service groups.
+func newUserGroupResource(ctx context.Context, userGroup iamUserGroup, roles []iamRole, serviceGroups []iamServiceGroup, services []iamService) (*v2.Resource, error) {
+	roleNames := make([]interface{}, 0, len(roles))
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+	}
+
+	serviceGroupNames := make([]interface{}, 0, len(serviceGroups))
+	for _, serviceGroup := range serviceGroups {
+		serviceGroupNames = append(serviceGroupNames, serviceGroup.Name)
+	}
+
+	serviceIds := make([]interface{}, 0, len(services))
+	serviceNames := make([]interface{}, 0, len(services))
+	for _, service := range services {
+		serviceIds = append(serviceIds, service.ID)
+		serviceNames = append(serviceNames, service.Name)
+	}
+
+	profile := map[string]interface{}{
+		"id":             userGroup.ID,
+		"name":           userGroup.Name,
+		"roles":          roleNames,
+		"service_groups": serviceGroupNames,
+		"service_ids":    serviceIds,
+		"services":       serviceNames,
+	}
+
+	if userGroup.Description != "" {
+		profile["description"] = userGroup.Description
+	}
+
+	addTimeToProfile(profile, "created_at", userGroup.CreatedAt)
+	addTimeToProfile(profile, "updated_at", userGroup.UpdatedAt)
+
+	groupTraitOptions := []rs.GroupTraitOption{
+		rs.WithGroupProfile(profile),
+	}
+
+	resource, err := rs.NewGroupResource(userGroup.Name, userGroupResourceType, userGroup.ID, groupTraitOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// List returns all IAM user groups. Accounts that have not been migrated to IAM have none.
+func (o *userGroupBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	userGroups, err := listUserGroups(o.client)
+	if err != nil {
+		if isNotFoundError(err) {
+			l.Debug("baton-fastly: user groups are not available for this account")
+			return nil, "", nil, nil
+		}
+
+		return nil, "", nil, wrapError(err, "error listing user groups")
+	}
+
+	// Service groups are usually assigned to several user groups, so their services are listed once.
+	serviceGroupServices := make(map[string][]iamService)
+
+	var resources []*v2.Resource
+	for _, userGroup := range userGroups {
+		roles, err := listUserGroupRoles(o.client, userGroup.ID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error listing user group roles")
+		}
+
+		serviceGroups, err := listUserGroupServiceGroups(o.client, userGroup.ID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error listing user group service groups")
+		}
+
+		var services []iamService
+		seen := make(map[string]bool)
+		for _, serviceGroup := range serviceGroups {
+			groupServices, ok := serviceGroupServices[serviceGroup.ID]
+			if !ok {
+				groupServices, err = listServiceGroupServices(o.client, serviceGroup.ID)
+				if err != nil {
+					return nil, "", nil, wrapError(err, "error listing service group services")
+				}
+
+				serviceGroupServices[serviceGroup.ID] = groupServices
+			}
+
+			for _, service := range groupServices {
+				if seen[service.ID] || !o.serviceFilter.matches(service.ID, service.Name, service.Type) {
+					continue
+				}
+
+				seen[service.ID] = true
+				services = append(services, service)
+			}
+		}
+
+		resource, err := newUserGroupResource(ctx, userGroup, roles, serviceGroups, services)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating user group resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *userGroupBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+
+	assigmentOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(userResourceType),
+		ent.WithDescription(fmt.Sprintf("Member of %s user group", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s user group %s", resource.DisplayName, memberEntitlement)),
+	}
+	rv = append(rv, ent.NewAssignmentEntitlement(resource, memberEntitlement, assigmentOptions...))
+
+	return rv, "", nil, nil
+}
+
+func (o *userGroupBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	members, err := listUserGroupMembers(o.client, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error listing user group members")
+	}
+
+	var rv []*v2.Grant
+	for _, member := range members {
+		if member.Object != "" && member.Object != "user" {
+			continue
+		}
+
+		userId, err := rs.NewResourceID(userResourceType, member.ID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "error creating user resource id")
+		}
+
+		rv = append(rv, grant.NewGrant(resource, memberEntitlement, userId))
+	}
+
+	return rv, "", nil, nil
+}
+
+func (o *userGroupBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if principal.Id.ResourceType != userResourceType.Id {
+		err := fmt.Errorf("baton-fastly: only users can be granted to user groups")
+
+		l.Warn(
+			err.Error(),
+			zap.String("principal_id", principal.Id.Resource),
+			zap.String("principal_type", principal.Id.ResourceType),
+		)
+
+		return nil, err
+	}
+
+	err := addUserGroupMember(o.client, entitlement.Resource.Id.Resource, principal.Id.Resource)
+	if err != nil {
+		err = wrapError(err, "failed to add user to user group")
+
+		l.Error(
+			err.Error(),
+			zap.String("user_group_id", entitlement.Resource.Id.Resource),
+			zap.String("user_id", principal.Id.Resource),
+		)
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (o *userGroupBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	principal := grant.Principal
+	entitlement := grant.Entitlement
+
+	if principal.Id.ResourceType != userResourceType.Id {
+		err := fmt.Errorf("baton-fastly: only users can be revoked from user groups")
+
+		l.Warn(
+			err.Error(),
+			zap.String("principal_id", principal.Id.Resource),
+			zap.String("principal_type", principal.Id.ResourceType),
+		)
+
+		return nil, err
+	}
+
+	err := removeUserGroupMember(o.client, entitlement.Resource.Id.Resource, principal.Id.Resource)
+	if err != nil {
+		err = wrapError(err, "failed to remove user from user group")
+
+		l.Error(
+			err.Error(),
+			zap.String("user_group_id", entitlement.Resource.Id.Resource),
+			zap.String("user_id", principal.Id.Resource),
+		)
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func newUserGroupBuilder(client *fastly.Client, customerId string, serviceFilter *serviceFilter) *userGroupBuilder {
+	return &userGroupBuilder{
+		resourceType:  userGroupResourceType,
+		client:        client,
+		customerId:    customerId,
+		serviceFilter: serviceFilter,
+	}
+}
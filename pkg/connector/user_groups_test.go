@@ -0,0 +1,69 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+func TestUserGroupProfileServices(t *testing.T) {
+	f := newFakeFastly(t, "cust")
+	f.services["svc-a"] = "Alpha"
+	f.services["svc-b"] = "Beta"
+	f.services["svc-c"] = "Gamma"
+	f.iamRoles["r-studio"] = "Studio Admin"
+	f.serviceGroups["sg-1"] = "Production"
+	f.serviceGroups["sg-2"] = "Staging"
+	f.serviceGroupServices["sg-1"] = []string{"svc-a", "svc-b"}
+	f.serviceGroupServices["sg-2"] = []string{"svc-b", "svc-c"}
+	f.userGroups["ug-1"] = "Engineers"
+	f.userGroups["ug-2"] = "Support"
+	f.userGroupRoles["ug-1"] = []string{"r-studio"}
+	f.userGroupServiceGroups["ug-1"] = []string{"sg-1", "sg-2"}
+	f.userGroupServiceGroups["ug-2"] = []string{"sg-1"}
+
+	resources, err := listAllResources(context.Background(), newUserGroupBuilder(f.client(), "cust", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[string]interface{}{
+		"ug-1": {
+			"roles":          []interface{}{"Studio Admin"},
+			"service_groups": []interface{}{"Production", "Staging"},
+			"service_ids":    []interface{}{"svc-a", "svc-b", "svc-c"},
+			"services":       []interface{}{"Alpha", "Beta", "Gamma"},
+		},
+		"ug-2": {
+			"roles":          []interface{}{},
+			"service_groups": []interface{}{"Production"},
+			"service_ids":    []interface{}{"svc-a", "svc-b"},
+			"services":       []interface{}{"Alpha", "Beta"},
+		},
+	}
+
+	if len(resources) != len(want) {
+		t.Fatalf("got %d user groups, want %d", len(resources), len(want))
+	}
+
+	for _, resource := range resources {
+		groupTrait, err := rs.GetGroupTrait(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		profile := groupTrait.GetProfile().AsMap()
+		for key, value := range want[resource.Id.Resource] {
+			if !reflect.DeepEqual(profile[key], value) {
+				t.Errorf("%s of %s = %v, want %v", key, resource.Id.Resource, profile[key], value)
+			}
+		}
+	}
+
+	if n := f.countRequests(http.MethodGet, "/service-groups/sg-1/services"); n != 1 {
+		t.Errorf("services of a service group were listed %d times, want once", n)
+	}
+}
@@ -2,7 +2,9 @@ package connector
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -12,38 +14,79 @@ import (
 )
 
 type userBuilder struct {
-	resourceType *v2.ResourceType
-	client       *fastly.Client
-	customerId   string
+	resourceType           *v2.ResourceType
+	client                 *fastly.Client
+	customerId             string
+	serviceAccountDetector *serviceAccountDetector
+	activityLookback       time.Duration
+}
+
+// userDetails holds the information about a user that is only gathered when listing users.
+type userDetails struct {
+	serviceAccount bool
+	activity       *activityReport
+	// missingRequiredTwoFactor is set when the account enforces 2FA but the user has not enabled it.
+	missingRequiredTwoFactor bool
 }
 
 func (o *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return userResourceType
 }
 
-func newUserResource(ctx context.Context, user *fastly.User) (*v2.Resource, error) {
-	firstName, lastName := parseName(user.Name)
+func newUserResource(ctx context.Context, user *fastly.User, details *userDetails) (*v2.Resource, error) {
+	firstName, lastName := splitName(user.Name)
 	profile := map[string]interface{}{
-		"customer_id": user.CustomerID,
-		"login":       user.Login,
-		"first_name":  firstName,
+		"customer_id":               user.CustomerID,
+		"login":                     user.Login,
+		"email":                     user.Login,
+		"first_name":                firstName,
+		"role":                      user.Role,
+		"two_factor_auth_enabled":   user.TwoFactorAuthEnabled,
+		"two_factor_setup_required": user.TwoFactorSetupRequired,
+		"require_new_password":      user.RequireNewPassword,
+		"limit_services":            user.LimitServices,
+		"locked":                    user.Locked,
 	}
 
 	if lastName != "" {
 		profile["last_name"] = lastName
 	}
 
-	var userStatus v2.UserTrait_Status_Status
-	if user.Locked {
-		userStatus = v2.UserTrait_Status_STATUS_DISABLED
-	} else {
-		userStatus = v2.UserTrait_Status_STATUS_ENABLED
+	addTimeToProfile(profile, "created_at", user.CreatedAt)
+	addTimeToProfile(profile, "updated_at", user.UpdatedAt)
+
+	if details != nil && details.activity != nil {
+		details.activity.addToProfile(profile, user.ID)
+	}
+
+	if details != nil && details.missingRequiredTwoFactor {
+		profile["missing_required_2fa"] = true
+	}
+
+	addTimeToProfile(profile, "deleted_at", user.DeletedAt)
+
+	userStatus, statusDetails := getUserStatus(user)
+	profile["status"] = statusDetails
+
+	if isNeverActivated(user) {
+		profile["never_activated"] = true
 	}
 
 	userTraits := []rs.UserTraitOption{
 		rs.WithUserProfile(profile),
-		rs.WithStatus(userStatus),
+		withStatusDetails(userStatus, statusDetails),
 		rs.WithUserLogin(user.Login),
+		rs.WithEmail(user.Login, true),
+	}
+
+	if icon := avatarAssetRef(user.EmailHash); icon != nil {
+		userTraits = append(userTraits, rs.WithUserIcon(icon))
+	}
+
+	if details != nil && details.serviceAccount {
+		userTraits = append(userTraits, rs.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE))
+	} else {
+		userTraits = append(userTraits, rs.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_HUMAN))
 	}
 
 	resource, err := rs.NewUserResource(user.Name, userResourceType, user.ID, userTraits)
@@ -54,14 +97,56 @@ func newUserResource(ctx context.Context, user *fastly.User) (*v2.Resource, erro
 	return resource, nil
 }
 
-func parseName(name string) (string, string) {
-	names := strings.Split(name, " ")
+const (
+	userStatusActive       = "active"
+	userStatusPendingSetup = "pending_setup"
+	userStatusLocked       = "locked"
+	userStatusDeleted      = "deleted"
+)
 
-	if len(names) == 1 {
-		return names[0], ""
+// isNeverActivated returns true for users that have not completed their account setup yet.
+func isNeverActivated(user *fastly.User) bool {
+	return user.RequireNewPassword || user.TwoFactorSetupRequired
+}
+
+// getUserStatus maps a Fastly user to a Baton status and a more detailed Fastly specific status.
+// Soft-deleted users are reported as deleted, locked users as disabled, and users that have never
+// completed their setup stay enabled but are told apart from active users by the details.
+func getUserStatus(user *fastly.User) (v2.UserTrait_Status_Status, string) {
+	switch {
+	case user.DeletedAt != nil && !user.DeletedAt.IsZero():
+		return v2.UserTrait_Status_STATUS_DELETED, userStatusDeleted
+	case user.Locked:
+		return v2.UserTrait_Status_STATUS_DISABLED, userStatusLocked
+	case isNeverActivated(user):
+		return v2.UserTrait_Status_STATUS_ENABLED, userStatusPendingSetup
+	default:
+		return v2.UserTrait_Status_STATUS_ENABLED, userStatusActive
 	}
+}
+
+// withStatusDetails is rs.WithStatus with the status details set as well.
+func withStatusDetails(status v2.UserTrait_Status_Status, details string) rs.UserTraitOption {
+	return func(ut *v2.UserTrait) error {
+		ut.Status = &v2.UserTrait_Status{Status: status, Details: details}
 
-	return names[0], names[1]
+		return nil
+	}
+}
+
+// splitName splits a full name into the given name, the first word, and the family name made of
+// all the remaining words, so that names with middle names or multi-word surnames are kept intact.
+func splitName(name string) (string, string) {
+	names := strings.Fields(name)
+
+	switch len(names) {
+	case 0:
+		return "", ""
+	case 1:
+		return names[0], ""
+	default:
+		return names[0], strings.Join(names[1:], " ")
+	}
 }
 
 // List returns all the users from the database as resource objects.
@@ -72,9 +157,30 @@ func (o *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 		return nil, "", nil, wrapError(err, "error listing users")
 	}
 
+	activity, err := newActivityReport(o.client, o.customerId, o.activityLookback)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error gathering user activity")
+	}
+
+	serviceAccounts, err := o.serviceAccountDetector.detect(o.client, users, activity)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error detecting service accounts")
+	}
+
+	customer, err := getCustomer(o.client, o.customerId)
+	if err != nil {
+		return nil, "", nil, wrapError(err, "error getting account security settings")
+	}
+
 	var resources []*v2.Resource
 	for _, user := range users {
-		resource, err := newUserResource(ctx, user)
+		details := &userDetails{
+			serviceAccount:           serviceAccounts[user.ID],
+			activity:                 activity,
+			missingRequiredTwoFactor: customer.Force2FA && !user.TwoFactorAuthEnabled,
+		}
+
+		resource, err := newUserResource(ctx, user, details)
 		if err != nil {
 			return nil, "", nil, wrapError(err, "error creating user resource")
 		}
@@ -95,10 +201,27 @@ func (o *userBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 	return nil, "", nil, nil
 }
 
-func newUserBuilder(client *fastly.Client, customerId string) *userBuilder {
+func newUserBuilder(client *fastly.Client, customerId string, serviceAccountLoginPatterns []string, activityLookback time.Duration) *userBuilder {
 	return &userBuilder{
-		resourceType: userResourceType,
-		client:       client,
-		customerId:   customerId,
+		resourceType:           userResourceType,
+		client:                 client,
+		customerId:             customerId,
+		serviceAccountDetector: newServiceAccountDetector(serviceAccountLoginPatterns),
+		activityLookback:       activityLookback,
 	}
 }
+
+type lockUserInput struct {
+	Locked fastly.Compatibool `url:"locked"`
+}
+
+// lockUser locks the user out of the account. The go-fastly v8 client cannot update the locked flag,
+// so the endpoint is called directly.
+func lockUser(client *fastly.Client, userId string) error {
+	resp, err := client.PutForm(fmt.Sprintf("/user/%s", userId), &lockUserInput{Locked: true}, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}